@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,6 +10,8 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/jswny/sad"
 )
 
 var binName = "sad"
@@ -78,6 +81,39 @@ func TestCLIInvalidFlag(t *testing.T) {
 	}
 }
 
+func TestCLIConfigJSON(t *testing.T) {
+	args := []string{"config", "-json", "-image", "user/foo"}
+	cmd, out, err := generateCmd(args)
+
+	if err != nil {
+		t.Fatalf("Error generating command to execute: %s", err)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Error executing command: %s", err)
+	}
+
+	var values []sad.OptionValue
+
+	if err := json.Unmarshal(out.Bytes(), &values); err != nil {
+		t.Fatalf("Error unmarshaling config output %s: %s", out.String(), err)
+	}
+
+	sources := make(map[string]string)
+
+	for _, value := range values {
+		sources[value.Name] = value.Source
+	}
+
+	if sources["image"] != "command line" {
+		t.Errorf("Expected image source command line but got %s", sources["image"])
+	}
+
+	if sources["channel"] != "default" {
+		t.Errorf("Expected channel source default but got %s", sources["channel"])
+	}
+}
+
 func generateCmd(args []string) (*exec.Cmd, *bytes.Buffer, error) {
 	dir, err := os.Getwd()
 	if err != nil {
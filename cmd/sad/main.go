@@ -2,24 +2,123 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jswny/sad"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
 )
 
-var deploymentCommand string = "docker-compose up -d"
+var deploymentCommandArgs string = "up -d"
+
+var pullCommandArgs string = "pull"
+
+var registryTimeout time.Duration = 30 * time.Second
+
+var deployCommandName string = "deploy"
+
+var configCommandName string = "config"
+
+var runCommandName string = "run"
+
+var shellCommandName string = "shell"
+
+var unlockCommandName string = "unlock"
+
+var statusCommandName string = "status"
+
+var historyCommandName string = "history"
+
+var defaultTerminal string = "xterm-256color"
+
+var commandNames = []string{
+	deployCommandName,
+	configCommandName,
+	runCommandName,
+	shellCommandName,
+	unlockCommandName,
+	statusCommandName,
+	historyCommandName,
+}
+
+var gitHubActionsEnvVar string = "GITHUB_ACTIONS"
+
+// redactor knows every secret value handled during the current command, and stdout redacts them from everything which is printed.
+// stdout must be closed before exiting, see exit.
+var redactor = sad.NewRedactor()
+
+var stdout io.WriteCloser = redactor.Writer(os.Stdout)
+
+// onFailure is called by fail before exiting, once the deployment holds the deployment lock.
+var onFailure func()
 
 func main() {
-	commandLineOpts, environmentOpts, configOpts := loadOptions()
+	program := os.Args[0]
+	command, args := GetCommand(os.Args[1:])
+
+	switch command {
+	case configCommandName:
+		showConfig(program+" "+command, args)
+	case runCommandName:
+		runRemoteCommand(program+" "+command, args)
+	case shellCommandName:
+		openShell(program+" "+command, args)
+	case unlockCommandName:
+		unlock(program+" "+command, args)
+	case statusCommandName:
+		showStatus(program+" "+command, args)
+	case historyCommandName:
+		showHistory(program+" "+command, args)
+	default:
+		deploy(program, args)
+	}
+
+	stdout.Close()
+}
+
+// GetCommand gets the command to run from the command line arguments, along with the remaining arguments.
+// If the first argument is not one of the commands, the deploy command is used with all of the arguments.
+func GetCommand(args []string) (command string, remainingArgs []string) {
+	if len(args) > 0 {
+		for _, commandName := range commandNames {
+			if args[0] == commandName {
+				return commandName, args[1:]
+			}
+		}
+	}
+
+	return deployCommandName, args
+}
+
+func deploy(program string, args []string) {
+	startedAt := time.Now()
+
+	commandLineOpts, environmentOpts, configOpts := loadOptions(program, args)
 
 	opts := checkOptions(commandLineOpts, environmentOpts, configOpts)
 
+	resolveDigest(opts)
+
+	composeFiles := findComposeFiles(opts)
+
+	env := loadDeploymentEnv(opts, composeFiles)
+
+	readerMap, files := prepareFiles(opts, composeFiles, env)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
 	clientConfig := configureSSHClient(opts)
 
 	sshClient := openSSHConnection(clientConfig, opts)
@@ -27,16 +126,100 @@ func main() {
 
 	remotePath := getRemotePath(opts)
 
+	release := newRelease(opts, startedAt)
+
 	createDeploymentDir(sshClient, remotePath)
 
-	deployFiles(sshClient, opts)
+	lock := acquireLock(sshClient, opts, remotePath)
+
+	// The failure is only recorded and the on-failure hooks are only run once the lock is held, so that they never run during another deployment.
+	// The lock is released last, even if an on-failure hook fails.
+	onFailure = func() {
+		onFailure = func() {
+			releaseLock(sshClient, remotePath, lock)
+		}
+
+		release.Finish(sad.ReleaseStatusFailed, time.Now())
+		appendAuditLog(sshClient, opts, remotePath, lock, release)
+
+		runHooks(sshClient, opts, sad.HookPhaseOnFailure, remotePath, composeFiles)
+
+		onFailure = nil
+		releaseLock(sshClient, remotePath, lock)
+	}
+
+	runHooks(sshClient, opts, sad.HookPhasePreUpload, remotePath, composeFiles)
+
+	deployFiles(sshClient, opts, readerMap)
+
+	loginToRegistry(sshClient, opts)
+
+	pullImage(sshClient, remotePath, sad.GetComposeCommand(composeFiles, pullCommandArgs), opts)
+
+	verifyImage(sshClient, opts)
+
+	logoutFromRegistry(sshClient, opts)
+
+	runHooks(sshClient, opts, sad.HookPhasePreStart, remotePath, composeFiles)
 
-	startApp(sshClient, remotePath, deploymentCommand)
+	startApp(sshClient, remotePath, sad.GetComposeCommand(composeFiles, deploymentCommandArgs))
+
+	// The release file describes the app which is running, so it is written as soon as the app is started.
+	// A failing post-start hook only marks the deployment as failed in the audit log.
+	release.Finish(sad.ReleaseStatusSucceeded, time.Now())
+	writeRelease(sshClient, remotePath, release)
+
+	runHooks(sshClient, opts, sad.HookPhasePostStart, remotePath, composeFiles)
+
+	appendAuditLog(sshClient, opts, remotePath, lock, release)
+
+	releaseLock(sshClient, remotePath, lock)
+}
+
+// exit writes any output which the redactor is still holding back, and then exits with the specified status.
+func exit(status int) {
+	stdout.Close()
+	os.Exit(status)
+}
+
+// fail exits after a deployment step fails, running the on-failure handler first if it is set up.
+// The handler is cleared before it runs, so it is only run once.
+func fail() {
+	if onFailure != nil {
+		handler := onFailure
+		onFailure = nil
+		handler()
+	}
+
+	exit(1)
 }
 
 // GetAllOptionSources gets options from each different source.
+// The config file is taken from the command line or environment variables if it is specified there, which must exist.
+// Otherwise, the specified config file name is used, and if it is empty no config file is used, see FindAllOptionSources to find the config file instead.
+// The path of the config file which was used, if any, is stored in the Config field of the config options.
 func GetAllOptionSources(program string, args []string, configFileName string) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options, commandLineOutput string, err error) {
-	commandLineOpts, output, err := ParseFlags(program, args)
+	return GetAllCommandOptionSources(program, args, configFileName, nil)
+}
+
+// GetAllCommandOptionSources gets options from each different source like GetAllOptionSources, with extra flags for a command defined by the provided function, see ParseCommandFlags.
+func GetAllCommandOptionSources(program string, args []string, configFileName string, defineCommandFlags func(flags *flag.FlagSet)) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options, commandLineOutput string, err error) {
+	return getAllOptionSources(program, args, configFileName, false, defineCommandFlags)
+}
+
+// FindAllOptionSources gets options from each different source like GetAllOptionSources.
+// If the config file is not specified on the command line or in the environment variables, it is found with sad.FindConfigFile from the current directory, and no config file is used if none is found.
+func FindAllOptionSources(program string, args []string) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options, commandLineOutput string, err error) {
+	return FindAllCommandOptionSources(program, args, nil)
+}
+
+// FindAllCommandOptionSources gets options from each different source like FindAllOptionSources, with extra flags for a command defined by the provided function, see ParseCommandFlags.
+func FindAllCommandOptionSources(program string, args []string, defineCommandFlags func(flags *flag.FlagSet)) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options, commandLineOutput string, err error) {
+	return getAllOptionSources(program, args, "", true, defineCommandFlags)
+}
+
+func getAllOptionSources(program string, args []string, configFileName string, findConfigFile bool, defineCommandFlags func(flags *flag.FlagSet)) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options, commandLineOutput string, err error) {
+	commandLineOpts, output, err := ParseCommandFlags(program, args, defineCommandFlags)
 	if err != nil {
 		return nil, nil, nil, output, err
 	}
@@ -47,44 +230,90 @@ func GetAllOptionSources(program string, args []string, configFileName string) (
 		return nil, nil, nil, "", err
 	}
 
+	configFileName, err = getConfigFilePath(commandLineOpts, environmentOpts, configFileName, findConfigFile)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
 	configOpts = &sad.Options{}
 	if configFileName != "" {
-		err = configOpts.FromJSON(configFileName)
+		err = configOpts.FromFile(configFileName)
 		if err != nil {
 			return nil, nil, nil, "", err
 		}
 	}
 
+	configOpts.Config = configFileName
+
 	return commandLineOpts, environmentOpts, configOpts, "", nil
 }
 
 // MergeOptionsHierarchy merges options from different sources together.
 // Options are merged in order starting from the options of least precedence to greatest precedence.
 // Thus, the options with greatest precedence will contain the merged options.
-// The sources in order of precedence are: command line, environment variables, config file.
+// The sources in order of precedence are: command line, environment variables, config file channel profile, config file.
+// The channel profile is selected using the channel from the first source that specifies one, or the default channel.
 func MergeOptionsHierarchy(commandLineOptions *sad.Options, environmentOptions *sad.Options, configOptions *sad.Options) {
-	environmentOptions.Merge(configOptions)
+	channel := getSelectedChannel(commandLineOptions, environmentOptions, configOptions)
+	channelOptions := configOptions.GetChannelOptions(channel)
+
+	environmentOptions.Merge(channelOptions)
 	commandLineOptions.Merge(environmentOptions)
 }
 
+// GetOptionLayers gets copies of the options from each source, including the selected channel profile and the defaults, as layers in order of precedence.
+// The layers can be used with sad.DescribeOptions to find the source of each option after the options are merged with MergeOptionsHierarchy.
+func GetOptionLayers(commandLineOptions *sad.Options, environmentOptions *sad.Options, configOptions *sad.Options) []sad.OptionLayer {
+	channel := getSelectedChannel(commandLineOptions, environmentOptions, configOptions)
+
+	layers := []sad.OptionLayer{
+		{Source: "command line", Options: commandLineOptions.Clone()},
+		{Source: "environment", Options: environmentOptions.Clone()},
+	}
+
+	if profile := configOptions.Channels[channel]; profile != nil {
+		layers = append(layers, sad.OptionLayer{Source: "channel profile " + channel, Options: profile.Clone()})
+	}
+
+	layers = append(layers,
+		sad.OptionLayer{Source: "config file " + configOptions.Config, Options: configOptions.Clone()},
+		sad.OptionLayer{Source: "default", Options: sad.GetDefaultOptions()},
+	)
+
+	return layers
+}
+
+func getSelectedChannel(commandLineOptions *sad.Options, environmentOptions *sad.Options, configOptions *sad.Options) string {
+	channel := sad.DefaultChannel
+
+	for _, opts := range []*sad.Options{configOptions, environmentOptions, commandLineOptions} {
+		if opts.Channel != "" {
+			channel = opts.Channel
+		}
+	}
+
+	return channel
+}
+
 // ParseFlags parses command line flags into options.
 // Flag parsing is always returned as output.
 // If help or usage is requested, flag.ErrHelp is returned.
 func ParseFlags(program string, args []string) (opts *sad.Options, output string, err error) {
+	return ParseCommandFlags(program, args, nil)
+}
+
+// ParseCommandFlags parses command line flags into options like ParseFlags.
+// If the provided function is not nil, it is called to define extra flags for a command, whose values can be read once parsing is done.
+func ParseCommandFlags(program string, args []string, defineCommandFlags func(flags *flag.FlagSet)) (opts *sad.Options, output string, err error) {
 	flags := flag.NewFlagSet(program, flag.ContinueOnError)
 	var buf bytes.Buffer
 	flags.SetOutput(&buf)
 
-	registry := flags.String("registry", "", "Docker image registry")
-	image := flags.String("image", "", "Docker image to deploy")
-	digest := flags.String("digest", "", "Docker image digest to deploy")
-	server := flags.String("server", "", "Server to deploy to")
-	username := flags.String("username", "", "User to login to on the server")
-	rootDir := flags.String("root-dir", "", "Root directory to deploy to on the server")
-	privateKey := flags.String("private-key", "", "Base64 encoded SSH private key to login to the user on the server")
-	channel := flags.String("channel", "", "Deployment channel")
-	envVars := flags.String("env-vars", "", "Local environment variables to be injected into the app deployment")
-	debug := flags.Bool("debug", false, "Debug mode")
+	if defineCommandFlags != nil {
+		defineCommandFlags(flags)
+	}
+
+	sad.DefineOptionFlags(flags)
 
 	err = flags.Parse(args)
 	if err != nil {
@@ -92,8 +321,7 @@ func ParseFlags(program string, args []string) (opts *sad.Options, output string
 	}
 
 	opts = &sad.Options{}
-	debugString := strconv.FormatBool(*debug)
-	err = opts.FromStrings(*registry, *image, *digest, *server, *username, *rootDir, *privateKey, *channel, *envVars, debugString)
+	err = opts.FromStringValues(sad.GetOptionFlagValues(flags))
 
 	if err != nil {
 		return nil, buf.String(), err
@@ -102,161 +330,995 @@ func ParseFlags(program string, args []string) (opts *sad.Options, output string
 	return opts, buf.String(), nil
 }
 
-func loadOptions() (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options) {
-	fmt.Print("Loading config... ")
+func getConfigFilePath(commandLineOpts *sad.Options, environmentOpts *sad.Options, configFileName string, findConfigFile bool) (string, error) {
+	explicitPath := commandLineOpts.Config
+
+	if explicitPath == "" {
+		explicitPath = environmentOpts.Config
+	}
+
+	if explicitPath != "" {
+		if _, err := os.Stat(explicitPath); err != nil {
+			return "", fmt.Errorf("error reading config file %s: %s", explicitPath, err)
+		}
+
+		return explicitPath, nil
+	}
+
+	if configFileName != "" || !findConfigFile {
+		return configFileName, nil
+	}
 
-	configFilePath, err := sad.FindFilePathRecursive(".", sad.ConfigFileName)
+	configFilePath, err := sad.FindConfigFile(".")
 
 	if err != nil {
 		if err.Error() == sad.FindFilePathRecursiveFileNotFoundErrorMessage {
-			fmt.Print("Could not find a config file, skipping... ")
-		} else {
-			fmt.Println("Error finding config file:", err)
-			os.Exit(1)
+			return "", nil
 		}
-	} else {
-		fmt.Print("Found config file: ", configFilePath, "... ")
+
+		return "", fmt.Errorf("error finding config file: %s", err)
 	}
 
-	commandLineOpts, environmentOpts, configOpts, commandLineOutput, err := GetAllOptionSources(os.Args[0], os.Args[1:], configFilePath)
+	return configFilePath, nil
+}
+
+func loadOptions(program string, args []string) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options) {
+	return loadCommandOptions(program, args, nil)
+}
+
+func loadCommandOptions(program string, args []string, defineCommandFlags func(flags *flag.FlagSet)) (commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options) {
+	fmt.Fprint(stdout, "Loading config... ")
+
+	commandLineOpts, environmentOpts, configOpts, commandLineOutput, err := FindAllCommandOptionSources(program, args, defineCommandFlags)
 	if err != nil {
 		if commandLineOutput != "" {
-			fmt.Println(commandLineOutput)
+			fmt.Fprintln(stdout, commandLineOutput)
 		}
 		if err == flag.ErrHelp {
-			os.Exit(2)
+			exit(2)
 		}
 
-		fmt.Println("Error retrieving options:", err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error retrieving options:", err)
+		exit(1)
+	}
+
+	if configOpts.Config == "" {
+		fmt.Fprint(stdout, "Could not find a config file, skipping... ")
+	} else {
+		fmt.Fprint(stdout, "Found config file: ", configOpts.Config, "... ")
 	}
 
-	fmt.Println("Success!")
+	fmt.Fprintln(stdout, "Success!")
 	return commandLineOpts, environmentOpts, configOpts
 }
 
+func showConfig(program string, args []string) {
+	var jsonOutput *bool
+
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		jsonOutput = flags.Bool("json", false, "Print the effective config as JSON")
+	}
+
+	commandLineOpts, environmentOpts, configOpts, commandLineOutput, err := FindAllCommandOptionSources(program, args, defineCommandFlags)
+	if err != nil {
+		if commandLineOutput != "" {
+			fmt.Fprintln(stdout, commandLineOutput)
+		}
+		if err == flag.ErrHelp {
+			exit(2)
+		}
+
+		fmt.Fprintln(stdout, "Error retrieving options:", err)
+		exit(1)
+	}
+
+	layers := GetOptionLayers(commandLineOpts, environmentOpts, configOpts)
+
+	MergeOptionsHierarchy(commandLineOpts, environmentOpts, configOpts)
+	commandLineOpts.MergeDefaults()
+
+	values := sad.DescribeOptions(commandLineOpts, layers)
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(values, "", "  ")
+
+		if err != nil {
+			fmt.Fprintln(stdout, "Error marshaling config to JSON:", err)
+			exit(1)
+		}
+
+		fmt.Fprintln(stdout, string(data))
+		return
+	}
+
+	writer := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "OPTION\tVALUE\tSOURCE")
+
+	for _, value := range values {
+		source := value.Source
+
+		if source == "" {
+			source = "unset"
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", value.Name, value.String(), source)
+	}
+
+	writer.Flush()
+}
+
 func checkOptions(commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options) *sad.Options {
-	fmt.Print("Verifying config... ")
+	return checkCommandOptions(commandLineOpts, environmentOpts, configOpts)
+}
+
+// checkCommandOptions merges and verifies the options like checkOptions, ignoring problems with the specified fields which the command doesn't need.
+func checkCommandOptions(commandLineOpts *sad.Options, environmentOpts *sad.Options, configOpts *sad.Options, ignoredFields ...string) *sad.Options {
+	fmt.Fprint(stdout, "Verifying config... ")
 
 	MergeOptionsHierarchy(commandLineOpts, environmentOpts, configOpts)
 	commandLineOpts.MergeDefaults()
 
+	redactor.AddOptions(commandLineOpts)
+
 	err := commandLineOpts.Verify()
+
+	var validationError *sad.ValidationError
+
+	if errors.As(err, &validationError) {
+		err = validationError.Without(ignoredFields...)
+	}
+
 	if err != nil {
-		fmt.Println("Provided options were invalid:", err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Provided options were invalid:")
+		printValidationError(err)
+		exit(1)
 	}
 
-	fmt.Println("Success!")
+	fmt.Fprintln(stdout, "Success!")
 	return commandLineOpts
 }
 
-func configureSSHClient(opts *sad.Options) *ssh.ClientConfig {
-	fmt.Print("Configuring SSH client... ")
+// runRemoteCommand runs a one-off command for a service of the deployment on the server, streaming its output and exiting with its exit status.
+// Progress is printed to standard error so that the output of the command can be piped.
+func runRemoteCommand(program string, args []string) {
+	var commandFlags *flag.FlagSet
+	var service *string
+	var execute *bool
+
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		commandFlags = flags
+		service = flags.String("service", "", "Docker Compose service to run the command for, instead of the one which uses the deployment image")
+		execute = flags.Bool("exec", false, "Run the command in the running container of the service instead of a new one")
+	}
 
-	clientConfig, err := sad.GetSSHClientConfig(opts)
+	stdout = redactor.Writer(os.Stderr)
 
-	if err != nil {
-		fmt.Println("Error getting SSH configuration from options:", err)
-		os.Exit(1)
+	commandLineOpts, environmentOpts, configOpts := loadCommandOptions(program, args, defineCommandFlags)
+
+	command := commandFlags.Args()
+
+	if len(command) == 0 {
+		fmt.Fprintf(stdout, "Usage: %s [options] -- <command> [arguments]\n", program)
+		exit(2)
 	}
 
-	fmt.Println("Success!")
+	opts := checkCommandOptions(commandLineOpts, environmentOpts, configOpts, "digest")
 
-	return clientConfig
-}
+	composeFiles := findComposeFiles(opts)
 
-func openSSHConnection(clientConfig *ssh.ClientConfig, opts *sad.Options) *ssh.Client {
-	fmt.Print("Opening SSH connection... ")
+	serviceName := *service
 
-	address := opts.Server.String()
-	port := "22"
+	if serviceName == "" {
+		serviceName = findImageService(opts, composeFiles)
+	}
 
-	sshClient, err := ssh.Dial("tcp", net.JoinHostPort(address, port), clientConfig)
+	clientConfig := configureSSHClient(opts)
+
+	sshClient := openSSHConnection(clientConfig, opts)
+	defer sshClient.Close()
+
+	remotePath := getRemotePath(opts)
+
+	cmd := sad.GetComposeRunCommand(remotePath, composeFiles, serviceName, *execute, command)
+
+	fmt.Fprintf(stdout, "Running %s in service %s...\n", strings.Join(command, " "), serviceName)
+
+	commandStdout := redactor.Writer(os.Stdout)
+	commandStderr := redactor.Writer(os.Stderr)
+
+	status, err := sad.SSHStreamCommand(sshClient, cmd, os.Stdin, commandStdout, commandStderr)
+
+	commandStdout.Close()
+	commandStderr.Close()
 
 	if err != nil {
-		msg := fmt.Sprintf("failed to open SSH connection to address %s:%s: %s", address, port, err)
-		fmt.Println(msg, err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error running command on server:", err)
+		exit(1)
 	}
 
-	fmt.Println("Success!")
-
-	return sshClient
+	sshClient.Close()
+	exit(status)
 }
 
-func getRemotePath(opts *sad.Options) string {
-	fmt.Print("Generating remote path... ")
+// openShell opens an interactive shell in the deployment container, or on the server in the deployment directory, and exits with the exit status of the shell.
+// The local terminal is put into raw mode while the shell is open, and the output of the shell is not redacted so that it is passed through unchanged.
+func openShell(program string, args []string) {
+	var shell *string
+	var host *bool
+
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		shell = flags.String("shell", "sh", "Shell to run in the deployment container")
+		host = flags.Bool("host", false, "Open a shell on the server in the deployment directory instead of in the deployment container")
+	}
+
+	commandLineOpts, environmentOpts, configOpts := loadCommandOptions(program, args, defineCommandFlags)
+
+	opts := checkCommandOptions(commandLineOpts, environmentOpts, configOpts, "digest")
+
+	fd := int(os.Stdin.Fd())
+
+	if !term.IsTerminal(fd) {
+		fmt.Fprintln(stdout, "Error opening shell: standard input is not a terminal, use run instead")
+		exit(1)
+	}
+
+	clientConfig := configureSSHClient(opts)
+
+	sshClient := openSSHConnection(clientConfig, opts)
+	defer sshClient.Close()
+
+	remotePath := getRemotePath(opts)
 
 	deploymentName, err := opts.GetDeploymentName()
 
 	if err != nil {
-		fmt.Println("Error getting full app name:", err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error getting deployment name:", err)
+		exit(1)
 	}
 
-	remotePath := fmt.Sprintf("%s/%s", opts.RootDir, deploymentName)
+	cmd := sad.GetShellCommand(remotePath, deploymentName, *shell, *host)
 
-	fmt.Println("Success!")
+	width, height, err := term.GetSize(fd)
 
-	return remotePath
+	if err != nil {
+		fmt.Fprintln(stdout, "Error getting terminal size:", err)
+		exit(1)
+	}
+
+	terminal := os.Getenv("TERM")
+
+	if terminal == "" {
+		terminal = defaultTerminal
+	}
+
+	oldState, err := term.MakeRaw(fd)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error setting terminal to raw mode:", err)
+		exit(1)
+	}
+
+	resize, stopResize := watchTerminalResize(fd)
+
+	size := sad.TerminalSize{Width: width, Height: height}
+	status, err := sad.SSHRunInteractiveCommand(sshClient, cmd, terminal, size, resize, os.Stdin, os.Stdout, os.Stderr)
+
+	stopResize()
+	term.Restore(fd, oldState)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error opening shell on server:", err)
+		exit(1)
+	}
+
+	sshClient.Close()
+	exit(status)
 }
 
-func createDeploymentDir(sshClient *ssh.Client, remotePath string) {
-	fmt.Print("Creating directory for deployment... ")
+// unlock removes the lock of the deployment on the server, which is left behind if Sad is killed in the middle of a deployment.
+// The lock is only removed with -force, so that it is not removed by accident while another deployment is in progress.
+func unlock(program string, args []string) {
+	var force *bool
 
-	cmd := fmt.Sprintf("mkdir -p %s", remotePath)
-	output, err := sad.SSHRunCommand(sshClient, cmd)
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		force = flags.Bool("force", false, "Remove the deployment lock even though another deployment may be in progress")
+	}
+
+	commandLineOpts, environmentOpts, configOpts := loadCommandOptions(program, args, defineCommandFlags)
+
+	opts := checkCommandOptions(commandLineOpts, environmentOpts, configOpts, "digest")
+
+	clientConfig := configureSSHClient(opts)
+
+	sshClient := openSSHConnection(clientConfig, opts)
+	defer sshClient.Close()
+
+	remotePath := getRemotePath(opts)
+
+	lock, err := sad.ReadLock(sshClient, remotePath)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error reading deployment lock:", err)
+
+		if !*force {
+			exit(1)
+		}
+	} else if lock == nil {
+		fmt.Fprintln(stdout, "Deployment is not locked")
+		return
+	} else {
+		fmt.Fprintln(stdout, "Deployment is locked by", lock)
+	}
+
+	if !*force {
+		fmt.Fprintln(stdout, "Pass -force to remove the lock if no deployment is in progress")
+		exit(1)
+	}
+
+	fmt.Fprint(stdout, "Removing deployment lock... ")
+
+	output, err := sad.SSHRunCommand(sshClient, sad.GetRemoveLockCommand(remotePath))
 
 	if err != nil {
-		fmt.Println("Error creating directory for deployment:", err)
+		fmt.Fprintln(stdout, "Error removing deployment lock:", err)
 		maybePrettyPrintOutput(output)
-		os.Exit(1)
+		exit(1)
 	}
 
-	maybePrettyPrintOutput(output)
-	fmt.Println("Success!")
+	fmt.Fprintln(stdout, "Success!")
 }
 
-func deployFiles(sshClient *ssh.Client, opts *sad.Options) {
-	fmt.Print("Sending files to server... ")
+// releaseStatus is the status of a deployment as printed by the status command.
+type releaseStatus struct {
+	Release   *sad.Release `json:"release"`
+	Container string       `json:"container"`
+	Lock      *sad.Lock    `json:"lock"`
+}
 
-	readerMap, files, err := sad.GetEntitiesForDeployment(".", opts)
+// showStatus prints the release currently running on the server, the status of the deployment container, and who holds the deployment lock, if anyone.
+// Progress is printed to standard error so that the status can be piped.
+func showStatus(program string, args []string) {
+	var jsonOutput *bool
 
-	for _, file := range files {
-		defer file.Close()
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		jsonOutput = flags.Bool("json", false, "Print the status as JSON")
 	}
 
+	stdout = redactor.Writer(os.Stderr)
+
+	commandLineOpts, environmentOpts, configOpts := loadCommandOptions(program, args, defineCommandFlags)
+
+	opts := checkCommandOptions(commandLineOpts, environmentOpts, configOpts, "digest")
+
+	clientConfig := configureSSHClient(opts)
+
+	sshClient := openSSHConnection(clientConfig, opts)
+	defer sshClient.Close()
+
+	remotePath := getRemotePath(opts)
+
+	deploymentName, err := opts.GetDeploymentName()
+
 	if err != nil {
-		fmt.Println("Error getting files for deployment:", err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error getting deployment name:", err)
+		exit(1)
 	}
 
-	err = sad.SendFiles(sshClient, opts, readerMap)
+	fmt.Fprint(stdout, "Reading deployment status... ")
+
+	status := releaseStatus{}
+
+	status.Release, err = sad.ReadRelease(sshClient, remotePath)
+
 	if err != nil {
-		fmt.Println("Error sending files to server:", err)
-		os.Exit(1)
+		fmt.Fprintln(stdout, "Error reading release:", err)
+		exit(1)
 	}
 
-	fmt.Println("Success!")
-}
+	status.Lock, err = sad.ReadLock(sshClient, remotePath)
 
-func startApp(sshClient *ssh.Client, remotePath string, deploymentCommand string) {
-	fmt.Print("Starting app on server... ")
+	if err != nil {
+		fmt.Fprintln(stdout, "Error reading deployment lock:", err)
+		exit(1)
+	}
 
-	cmd := fmt.Sprintf("cd %s && %s", remotePath, deploymentCommand)
+	output, err := sad.SSHRunCommand(sshClient, sad.GetContainerStatusCommand(deploymentName))
 
-	output, err := sad.SSHRunCommand(sshClient, cmd)
+	status.Container = strings.TrimSpace(output)
 
 	if err != nil {
-		fmt.Println("Error starting app on server:", err)
-		maybePrettyPrintOutput(output)
-		os.Exit(1)
+		status.Container = "not found"
 	}
 
-	fmt.Println("Success!")
+	fmt.Fprintln(stdout, "Success!")
 
-	maybePrettyPrintOutput(output)
+	statusOutput := redactor.Writer(os.Stdout)
+	defer statusOutput.Close()
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(status, "", "  ")
+
+		if err != nil {
+			fmt.Fprintln(stdout, "Error marshaling status to JSON:", err)
+			exit(1)
+		}
+
+		fmt.Fprintln(statusOutput, string(data))
+		return
+	}
+
+	writer := tabwriter.NewWriter(statusOutput, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "Deployment:\t%s\n", deploymentName)
+	fmt.Fprintf(writer, "Container:\t%s\n", status.Container)
+
+	if status.Lock == nil {
+		fmt.Fprintf(writer, "Lock:\t%s\n", "not locked")
+	} else {
+		fmt.Fprintf(writer, "Lock:\tlocked by %s\n", status.Lock)
+	}
+
+	if status.Release == nil {
+		fmt.Fprintf(writer, "Release:\t%s\n", "nothing deployed yet")
+	} else {
+		fmt.Fprintf(writer, "Image:\t%s\n", status.Release.Image)
+
+		if status.Release.Tag != "" {
+			fmt.Fprintf(writer, "Tag:\t%s\n", status.Release.Tag)
+		}
+
+		fmt.Fprintf(writer, "Channel:\t%s\n", status.Release.Channel)
+		fmt.Fprintf(writer, "Deployed by:\t%s\n", status.Release.Deployer)
+
+		if status.Release.GitSHA != "" {
+			fmt.Fprintf(writer, "Git SHA:\t%s\n", status.Release.GitSHA)
+		}
+
+		fmt.Fprintf(writer, "Started:\t%s\n", status.Release.StartedAt.Format(time.RFC3339))
+		fmt.Fprintf(writer, "Finished:\t%s\n", status.Release.FinishedAt.Format(time.RFC3339))
+	}
+
+	writer.Flush()
+}
+
+// historyEntry is a release as printed by the history command, along with how long it took.
+type historyEntry struct {
+	sad.Release
+	Duration string `json:"duration"`
+}
+
+// showHistory prints the previous deployments recorded in the audit log on the server, newest first, optionally filtered.
+// Progress is printed to standard error so that the history can be piped.
+func showHistory(program string, args []string) {
+	var jsonOutput *bool
+	var status *string
+	var deployer *string
+	var since *string
+	var limit *int
+
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		jsonOutput = flags.Bool("json", false, "Print the history as JSON")
+		status = flags.String("status", "", "Only show deployments with this outcome: "+sad.ReleaseStatusSucceeded+" or "+sad.ReleaseStatusFailed)
+		deployer = flags.String("deployer", "", "Only show deployments by this deployer")
+		since = flags.String("since", "", "Only show deployments started since a duration ago such as 24h, a date such as 2021-09-01, or a time such as 2021-09-01T12:00:00Z")
+		limit = flags.Int("limit", 0, "Maximum number of deployments to show, or 0 to show all of them")
+	}
+
+	stdout = redactor.Writer(os.Stderr)
+
+	commandLineOpts, environmentOpts, configOpts := loadCommandOptions(program, args, defineCommandFlags)
+
+	filter := sad.ReleaseFilter{
+		Status:   *status,
+		Deployer: *deployer,
+		Limit:    *limit,
+	}
+
+	if filter.Status != "" && filter.Status != sad.ReleaseStatusSucceeded && filter.Status != sad.ReleaseStatusFailed {
+		fmt.Fprintf(stdout, "Invalid status \"%s\", should be one of %s, %s\n", filter.Status, sad.ReleaseStatusSucceeded, sad.ReleaseStatusFailed)
+		exit(2)
+	}
+
+	if *since != "" {
+		sinceTime, err := sad.ParseSince(*since, time.Now())
+
+		if err != nil {
+			fmt.Fprintln(stdout, "Invalid since:", err)
+			exit(2)
+		}
+
+		filter.Since = sinceTime
+	}
+
+	opts := checkCommandOptions(commandLineOpts, environmentOpts, configOpts, "digest")
+
+	clientConfig := configureSSHClient(opts)
+
+	sshClient := openSSHConnection(clientConfig, opts)
+	defer sshClient.Close()
+
+	remotePath := getRemotePath(opts)
+
+	fmt.Fprint(stdout, "Reading audit log... ")
+
+	releases, err := sad.ReadAuditLog(sshClient, remotePath)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error reading audit log:", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	releases = sad.FilterReleases(releases, filter)
+
+	entries := make([]historyEntry, len(releases))
+
+	for i, release := range releases {
+		entries[i] = historyEntry{
+			Release:  release,
+			Duration: release.Duration().Round(time.Second).String(),
+		}
+	}
+
+	historyOutput := redactor.Writer(os.Stdout)
+	defer historyOutput.Close()
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(entries, "", "  ")
+
+		if err != nil {
+			fmt.Fprintln(stdout, "Error marshaling history to JSON:", err)
+			exit(1)
+		}
+
+		fmt.Fprintln(historyOutput, string(data))
+		return
+	}
+
+	writer := tabwriter.NewWriter(historyOutput, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STARTED\tDIGEST\tDEPLOYER\tSTATUS\tDURATION")
+
+	for _, entry := range entries {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", entry.StartedAt.Format(time.RFC3339), entry.Digest, entry.Deployer, entry.Status, entry.Duration)
+	}
+
+	writer.Flush()
+}
+
+func findImageService(opts *sad.Options, composeFiles []sad.ComposeFile) string {
+	fmt.Fprint(stdout, "Finding service for deployment image... ")
+
+	service, err := sad.FindImageService(composeFiles, opts)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error finding service, specify one with -service:", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	return service
+}
+
+func resolveDigest(opts *sad.Options) {
+	if opts.Tag == "" {
+		return
+	}
+
+	fmt.Fprint(stdout, "Resolving tag to digest... ")
+
+	client := &http.Client{
+		Timeout: registryTimeout,
+	}
+
+	err := opts.ResolveDigest(client)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error resolving tag:", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+	fmt.Fprintf(stdout, "Resolved tag %s to digest %s\n", opts.Tag, opts.Digest)
+}
+
+// loadDeploymentEnv loads the deployment environment once for the deployment, since loading it decrypts the secrets.
+func loadDeploymentEnv(opts *sad.Options, composeFiles []sad.ComposeFile) map[string]string {
+	fmt.Fprint(stdout, "Loading deployment environment... ")
+
+	env, secretEnv, err := sad.GetDeploymentEnv(composeFiles, opts)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error loading deployment environment:", err)
+		exit(1)
+	}
+
+	redactor.AddValues(secretEnv)
+
+	fmt.Fprintln(stdout, "Success!")
+
+	if os.Getenv(gitHubActionsEnvVar) == "true" {
+		err = redactor.WriteGitHubMasks(os.Stdout)
+
+		if err != nil {
+			fmt.Fprintln(stdout, "Error masking secrets in GitHub Actions:", err)
+			exit(1)
+		}
+	}
+
+	return env
+}
+
+func findComposeFiles(opts *sad.Options) []sad.ComposeFile {
+	fmt.Fprint(stdout, "Finding Docker Compose files... ")
+
+	composeFiles, err := sad.FindComposeFiles(".", opts)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error finding Docker Compose files:", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	for _, composeFile := range composeFiles {
+		fmt.Fprintf(stdout, "Using %s as %s\n", composeFile.LocalPath, composeFile.RemoteName)
+	}
+
+	return composeFiles
+}
+
+func printValidationError(err error) {
+	var validationError *sad.ValidationError
+
+	if !errors.As(err, &validationError) {
+		fmt.Fprintln(stdout, err)
+		return
+	}
+
+	for _, fieldError := range validationError.Errors {
+		line := "- " + fieldError.Error()
+
+		if source := fieldError.Source.String(); source != "" {
+			line += fmt.Sprintf(" (set with the %s)", source)
+		}
+
+		fmt.Fprintln(stdout, line)
+	}
+}
+
+func configureSSHClient(opts *sad.Options) *ssh.ClientConfig {
+	fmt.Fprint(stdout, "Configuring SSH client... ")
+
+	clientConfig, err := sad.GetSSHClientConfig(opts)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error getting SSH configuration from options:", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	return clientConfig
+}
+
+func openSSHConnection(clientConfig *ssh.ClientConfig, opts *sad.Options) *ssh.Client {
+	fmt.Fprint(stdout, "Opening SSH connection... ")
+
+	address := opts.Server.String()
+	port := "22"
+
+	sshClient, err := ssh.Dial("tcp", net.JoinHostPort(address, port), clientConfig)
+
+	if err != nil {
+		msg := fmt.Sprintf("failed to open SSH connection to address %s:%s: %s", address, port, err)
+		fmt.Fprintln(stdout, msg, err)
+		exit(1)
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	return sshClient
+}
+
+func getRemotePath(opts *sad.Options) string {
+	fmt.Fprint(stdout, "Generating remote path... ")
+
+	deploymentName, err := opts.GetDeploymentName()
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error getting full app name:", err)
+		exit(1)
+	}
+
+	remotePath := fmt.Sprintf("%s/%s", opts.RootDir, deploymentName)
+
+	fmt.Fprintln(stdout, "Success!")
+
+	return remotePath
+}
+
+func createDeploymentDir(sshClient *ssh.Client, remotePath string) {
+	fmt.Fprint(stdout, "Creating directory for deployment... ")
+
+	cmd := fmt.Sprintf("mkdir -p %s", remotePath)
+	output, err := sad.SSHRunCommand(sshClient, cmd)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error creating directory for deployment:", err)
+		maybePrettyPrintOutput(output)
+		fail()
+	}
+
+	maybePrettyPrintOutput(output)
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func prepareFiles(opts *sad.Options, composeFiles []sad.ComposeFile, env map[string]string) (map[string]io.Reader, []*os.File) {
+	fmt.Fprint(stdout, "Preparing files for deployment... ")
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(".", composeFiles, env, opts)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error getting files for deployment:", err)
+		fail()
+	}
+
+	unused, err := sad.ValidateComposeFiles(readerMap, composeFiles)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error validating Docker Compose files:", err)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	if len(unused) != 0 {
+		fmt.Fprintf(stdout, "Warning: variables %s are not used by the Docker Compose files\n", strings.Join(unused, ", "))
+	}
+
+	return readerMap, files
+}
+
+func deployFiles(sshClient *ssh.Client, opts *sad.Options, readerMap map[string]io.Reader) {
+	fmt.Fprint(stdout, "Sending files to server... ")
+
+	if opts.Sync == sad.SyncModeChanged || opts.Sync == sad.SyncModeMirror {
+		result, err := sad.SyncFiles(sshClient, opts, readerMap, opts.Sync == sad.SyncModeMirror)
+		if err != nil {
+			fmt.Fprintln(stdout, "Error syncing files to server:", err)
+			fail()
+		}
+
+		fmt.Fprintln(stdout, "Success!")
+		fmt.Fprintf(stdout, "Synced files: %s\n", result)
+		return
+	}
+
+	err := sad.SendFiles(sshClient, opts, readerMap)
+	if err != nil {
+		fmt.Fprintln(stdout, "Error sending files to server:", err)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func loginToRegistry(sshClient *ssh.Client, opts *sad.Options) {
+	if opts.RegistryUsername == "" {
+		return
+	}
+
+	fmt.Fprint(stdout, "Logging in to registry on server... ")
+
+	cmd := sad.GetRegistryLoginCommand(opts)
+	stdin := strings.NewReader(opts.RegistryPassword)
+
+	output, err := sad.SSHRunCommandWithStdin(sshClient, cmd, stdin)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error logging in to registry on server:", err)
+		maybePrettyPrintOutput(output)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func logoutFromRegistry(sshClient *ssh.Client, opts *sad.Options) {
+	if opts.RegistryUsername == "" || !opts.RegistryLogout {
+		return
+	}
+
+	fmt.Fprint(stdout, "Logging out from registry on server... ")
+
+	cmd := sad.GetRegistryLogoutCommand(opts)
+
+	output, err := sad.SSHRunCommand(sshClient, cmd)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error logging out from registry on server:", err)
+		maybePrettyPrintOutput(output)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func pullImage(sshClient *ssh.Client, remotePath string, pullCommand string, opts *sad.Options) {
+	fmt.Fprint(stdout, "Pulling image on server... ")
+
+	cmd := fmt.Sprintf("cd %s && %s", remotePath, pullCommand)
+
+	output, err := sad.SSHRunCommand(sshClient, cmd)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error pulling image on server, the existing app was left running:", err)
+		maybePrettyPrintOutput(output)
+		logoutFromRegistry(sshClient, opts)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	maybePrettyPrintOutput(output)
+}
+
+func verifyImage(sshClient *ssh.Client, opts *sad.Options) {
+	fmt.Fprint(stdout, "Verifying pulled image digest... ")
+
+	cmd := sad.GetImageRepoDigestsCommand(opts)
+
+	output, err := sad.SSHRunCommand(sshClient, cmd)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error inspecting pulled image on server, the existing app was left running:", err)
+		maybePrettyPrintOutput(output)
+		logoutFromRegistry(sshClient, opts)
+		fail()
+	}
+
+	repoDigests, err := sad.ParseRepoDigests(output)
+
+	if err == nil {
+		err = sad.VerifyRepoDigests(repoDigests, opts.Digest)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error verifying pulled image, the existing app was left running:", err)
+		logoutFromRegistry(sshClient, opts)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func startApp(sshClient *ssh.Client, remotePath string, deploymentCommand string) {
+	fmt.Fprint(stdout, "Starting app on server... ")
+
+	cmd := fmt.Sprintf("cd %s && %s", remotePath, deploymentCommand)
+
+	output, err := sad.SSHRunCommand(sshClient, cmd)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error starting app on server:", err)
+		maybePrettyPrintOutput(output)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	maybePrettyPrintOutput(output)
+}
+
+func acquireLock(sshClient *ssh.Client, opts *sad.Options, remotePath string) *sad.Lock {
+	fmt.Fprintf(stdout, "Acquiring deployment lock, waiting up to %s... ", opts.LockTimeout)
+
+	lock, err := sad.NewLock()
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error creating deployment lock:", err)
+		fail()
+	}
+
+	timeout, err := sad.ParseLockTimeout(opts.LockTimeout)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error parsing lock timeout:", err)
+		fail()
+	}
+
+	staleLock, err := sad.AcquireLock(sshClient, remotePath, lock, timeout)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error acquiring deployment lock:", err)
+		fail()
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+
+	if staleLock != nil {
+		fmt.Fprintf(stdout, "Warning: took over the stale deployment lock held by %s\n", staleLock)
+	}
+
+	return lock
+}
+
+// releaseLock releases the deployment lock, only printing a warning if it fails so that the outcome of the deployment is not changed.
+func releaseLock(sshClient *ssh.Client, remotePath string, lock *sad.Lock) {
+	fmt.Fprint(stdout, "Releasing deployment lock... ")
+
+	err := sad.ReleaseLock(sshClient, remotePath, lock)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Warning: error releasing deployment lock, remove it with unlock -force:", err)
+		return
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func newRelease(opts *sad.Options, startedAt time.Time) *sad.Release {
+	release, err := sad.NewRelease(".", opts, startedAt)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Error creating release:", err)
+		exit(1)
+	}
+
+	return release
+}
+
+// writeRelease writes the release file, only printing a warning if it fails so that the outcome of the deployment is not changed.
+func writeRelease(sshClient *ssh.Client, remotePath string, release *sad.Release) {
+	fmt.Fprint(stdout, "Writing release file... ")
+
+	err := sad.WriteRelease(sshClient, remotePath, release)
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Warning: error writing release file:", err)
+		return
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+// appendAuditLog appends the release to the audit log and prunes it to the history retention, only printing a warning if it fails so that the outcome of the deployment is not changed.
+// It must only be called while the deployment lock is held, since the audit log is left unchanged otherwise.
+func appendAuditLog(sshClient *ssh.Client, opts *sad.Options, remotePath string, lock *sad.Lock, release *sad.Release) {
+	fmt.Fprint(stdout, "Recording deployment in audit log... ")
+
+	err := sad.AppendAuditLog(sshClient, remotePath, lock, release)
+
+	if err == nil && opts.HistoryRetention > 0 {
+		err = sad.PruneAuditLog(sshClient, remotePath, lock, opts.HistoryRetention)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stdout, "Warning: error recording deployment in audit log:", err)
+		return
+	}
+
+	fmt.Fprintln(stdout, "Success!")
+}
+
+func runHooks(sshClient *ssh.Client, opts *sad.Options, phase string, remotePath string, composeFiles []sad.ComposeFile) {
+	for _, hook := range opts.Hooks[phase] {
+		fmt.Fprintf(stdout, "Running %s hook %s... ", phase, hook)
+
+		output, err := sad.RunHook(sshClient, ".", remotePath, composeFiles, hook)
+
+		if err != nil {
+			fmt.Fprintf(stdout, "Error running %s hook: %s\n", phase, err)
+			maybePrettyPrintOutput(output)
+			fail()
+		}
+
+		fmt.Fprintln(stdout, "Success!")
+
+		maybePrettyPrintOutput(output)
+	}
 }
 
 func maybePrettyPrintOutput(output string) {
@@ -272,6 +1334,6 @@ func maybePrettyPrintOutput(output string) {
 	}
 
 	if prettyOutput != "" {
-		fmt.Println(prettyOutput)
+		fmt.Fprintln(stdout, prettyOutput)
 	}
 }
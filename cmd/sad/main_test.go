@@ -2,8 +2,12 @@ package main_test
 
 import (
 	"encoding/json"
+	"flag"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jswny/sad"
@@ -55,11 +59,145 @@ func TestGetAllOptionSources(t *testing.T) {
 		t.Errorf("Expected empty output but got: %s", commandLineOutput)
 	}
 
-	testutils.CompareOpts(expectedOpts, *commandLineOpts, t)
 	testutils.CompareOpts(expectedOpts, *environmentOpts, t)
+
+	expectedOpts.RegistryPassword = ""
+
+	testutils.CompareOpts(expectedOpts, *commandLineOpts, t)
 	testutils.CompareOpts(expectedOpts, *configOpts, t)
 }
 
+func TestGetAllOptionSourcesConfigFlag(t *testing.T) {
+	tempFile, err := ioutil.TempFile(".", "config.test.*.yml")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), []byte("rootDir: /srv\n"), 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	args := []string{"-config", tempFile.Name()}
+
+	_, _, configOpts, _, err := main.GetAllOptionSources("sad", args, "")
+
+	if err != nil {
+		t.Fatalf("Error getting all option sources: %s", err)
+	}
+
+	testutils.CompareStrings("root directory", "/srv", configOpts.RootDir, t)
+	testutils.CompareStrings("config", tempFile.Name(), configOpts.Config, t)
+}
+
+func TestGetAllOptionSourcesConfigEnv(t *testing.T) {
+	tempFile, err := ioutil.TempFile(".", "config.test.*.json")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), []byte(`{"rootDir": "/srv"}`), 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	variables := map[string]string{
+		"CONFIG": tempFile.Name(),
+	}
+
+	testutils.SetEnvVars(variables, sad.OptionEnvVarPrefix)
+	defer testutils.UnsetEnvVars([]string{"CONFIG"}, sad.OptionEnvVarPrefix)
+
+	_, _, configOpts, _, err := main.GetAllOptionSources("sad", nil, "ignored.json")
+
+	if err != nil {
+		t.Fatalf("Error getting all option sources: %s", err)
+	}
+
+	testutils.CompareStrings("root directory", "/srv", configOpts.RootDir, t)
+	testutils.CompareStrings("config", tempFile.Name(), configOpts.Config, t)
+}
+
+func TestGetAllOptionSourcesConfigMissing(t *testing.T) {
+	args := []string{"-config", "missing.sad.json"}
+
+	_, _, _, _, err := main.GetAllOptionSources("sad", args, "")
+
+	if err == nil {
+		t.Fatalf("Expected error getting all option sources with a missing config file but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "missing.sad.json") {
+		t.Errorf("Expected error to contain config file path but got: %s", err)
+	}
+}
+
+func TestGetAllOptionSourcesNoConfigFile(t *testing.T) {
+	tempDirPath := createConfigTestDir(t)
+
+	_, _, configOpts, _, err := main.GetAllOptionSources("sad", nil, "")
+
+	if err != nil {
+		t.Fatalf("Error getting all option sources: %s", err)
+	}
+
+	testutils.CompareStrings("root directory", "", configOpts.RootDir, t)
+	testutils.CompareStrings("config", "", configOpts.Config, t)
+
+	if _, err := os.Stat(filepath.Join(tempDirPath, sad.ConfigFileNames[0])); err != nil {
+		t.Errorf("Expected config file to exist but got: %s", err)
+	}
+}
+
+func TestFindAllOptionSources(t *testing.T) {
+	tempDirPath := createConfigTestDir(t)
+
+	_, _, configOpts, _, err := main.FindAllOptionSources("sad", nil)
+
+	if err != nil {
+		t.Fatalf("Error finding all option sources: %s", err)
+	}
+
+	testutils.CompareStrings("root directory", "/srv", configOpts.RootDir, t)
+	testutils.CompareStrings("config", filepath.Join(tempDirPath, sad.ConfigFileNames[0]), configOpts.Config, t)
+}
+
+// createConfigTestDir creates a temporary directory with a config file, and changes into it until the test finishes.
+func createConfigTestDir(t *testing.T) string {
+	tempDirPath, err := ioutil.TempDir("", "sad-config-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	configPath := filepath.Join(tempDirPath, sad.ConfigFileNames[0])
+
+	if err := ioutil.WriteFile(configPath, []byte(`{"rootDir": "/srv"}`), 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	workingDir, err := os.Getwd()
+
+	if err != nil {
+		t.Fatalf("Error getting working directory: %s", err)
+	}
+
+	if err := os.Chdir(tempDirPath); err != nil {
+		t.Fatalf("Error changing into temp dir: %s", err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(workingDir)
+		os.RemoveAll(tempDirPath)
+	})
+
+	return tempDirPath
+}
+
 func TestMergeOptionsHierarchy(t *testing.T) {
 	commandLineOpts := testutils.GetTestOpts()
 	environmentOpts := testutils.GetTestOpts()
@@ -81,6 +219,8 @@ func TestMergeOptionsHierarchy(t *testing.T) {
 		t.Fatalf("Error unmarshaling command line options: %s", err)
 	}
 
+	expectedOpts.RegistryPassword = commandLineOpts.RegistryPassword
+
 	expectedOpts.Username = environmentOpts.Username
 	expectedOpts.RootDir = configOpts.RootDir
 
@@ -89,6 +229,182 @@ func TestMergeOptionsHierarchy(t *testing.T) {
 	testutils.CompareOpts(expectedOpts, commandLineOpts, t)
 }
 
+func TestMergeOptionsHierarchyChannelProfile(t *testing.T) {
+	commandLineOpts := sad.Options{
+		Channel: "prod",
+	}
+
+	environmentOpts := sad.Options{
+		RootDir: "/env",
+	}
+
+	configOpts := sad.Options{
+		Username: "config",
+		RootDir:  "/config",
+		Server:   net.ParseIP("1.2.3.4"),
+		Channels: map[string]*sad.Options{
+			"prod": {
+				RootDir: "/prod",
+				Server:  net.ParseIP("5.6.7.8"),
+			},
+			"beta": {
+				Username: "beta",
+			},
+		},
+	}
+
+	main.MergeOptionsHierarchy(&commandLineOpts, &environmentOpts, &configOpts)
+
+	testutils.CompareStrings("channel", "prod", commandLineOpts.Channel, t)
+	testutils.CompareStrings("username", "config", commandLineOpts.Username, t)
+	testutils.CompareStrings("root directory", "/env", commandLineOpts.RootDir, t)
+	testutils.CompareStrings("server", "5.6.7.8", commandLineOpts.Server.String(), t)
+}
+
+func TestMergeOptionsHierarchyDefaultChannelProfile(t *testing.T) {
+	commandLineOpts := sad.Options{}
+	environmentOpts := sad.Options{}
+
+	configOpts := sad.Options{
+		Username: "config",
+		Channels: map[string]*sad.Options{
+			sad.DefaultChannel: {
+				Username: "default",
+			},
+		},
+	}
+
+	main.MergeOptionsHierarchy(&commandLineOpts, &environmentOpts, &configOpts)
+
+	testutils.CompareStrings("username", "default", commandLineOpts.Username, t)
+}
+
+func TestMergeOptionsHierarchyExplicitZeroValues(t *testing.T) {
+	args := []string{"-debug=false", "-env-vars=", "-history-retention=0"}
+
+	commandLineOpts, _, err := main.ParseFlags("sad", args)
+	if err != nil {
+		t.Fatalf("Error parsing flags: %s", err)
+	}
+
+	environmentOpts := sad.Options{}
+
+	configOpts := sad.Options{
+		Debug: true,
+		EnvVars: []string{
+			"FOO",
+		},
+		RegistryLogout:   true,
+		HistoryRetention: 10,
+	}
+
+	main.MergeOptionsHierarchy(commandLineOpts, &environmentOpts, &configOpts)
+
+	if commandLineOpts.Debug {
+		t.Errorf("Expected debug false from the command line to override the config file")
+	}
+
+	if len(commandLineOpts.EnvVars) != 0 {
+		t.Errorf("Expected empty environment variables from the command line to override the config file but got %s", commandLineOpts.EnvVars)
+	}
+
+	if !commandLineOpts.RegistryLogout {
+		t.Errorf("Expected registry logout from the config file to be kept")
+	}
+
+	if commandLineOpts.HistoryRetention != 0 {
+		t.Errorf("Expected history retention 0 from the command line to override the config file but got %d", commandLineOpts.HistoryRetention)
+	}
+}
+
+func TestGetCommand(t *testing.T) {
+	command, args := main.GetCommand([]string{"config", "-json"})
+
+	testutils.CompareStrings("command", "config", command, t)
+
+	if len(args) != 1 || args[0] != "-json" {
+		t.Errorf("Expected remaining arguments [-json] but got %s", args)
+	}
+
+	command, args = main.GetCommand([]string{"-image", "foo"})
+
+	testutils.CompareStrings("command", "deploy", command, t)
+
+	if len(args) != 2 {
+		t.Errorf("Expected all arguments to remain but got %s", args)
+	}
+}
+
+func TestGetCommandRun(t *testing.T) {
+	command, args := main.GetCommand([]string{"run", "-channel", "prod", "--", "rake", "db:migrate"})
+
+	testutils.CompareStrings("command", "run", command, t)
+
+	if len(args) != 5 {
+		t.Errorf("Expected remaining arguments [-channel prod -- rake db:migrate] but got %s", args)
+	}
+}
+
+func TestParseCommandFlagsRemainingArgs(t *testing.T) {
+	var commandFlags *flag.FlagSet
+	var service *string
+
+	defineCommandFlags := func(flags *flag.FlagSet) {
+		commandFlags = flags
+		service = flags.String("service", "", "Service")
+	}
+
+	args := []string{"-channel", "prod", "-service", "worker", "--", "ls", "-la"}
+
+	opts, _, err := main.ParseCommandFlags("sad run", args, defineCommandFlags)
+	if err != nil {
+		t.Fatalf("Error parsing flags: %s", err)
+	}
+
+	testutils.CompareStrings("channel", "prod", opts.Channel, t)
+	testutils.CompareStrings("service", "worker", *service, t)
+	testutils.CompareStrings("remaining arguments", "ls -la", strings.Join(commandFlags.Args(), " "), t)
+}
+
+func TestGetOptionLayers(t *testing.T) {
+	commandLineOpts := sad.Options{
+		Channel: "prod",
+	}
+
+	environmentOpts := sad.Options{}
+
+	configOpts := sad.Options{
+		Config: ".sad.json",
+		Channels: map[string]*sad.Options{
+			"prod": {
+				RootDir: "/prod",
+			},
+		},
+	}
+
+	layers := main.GetOptionLayers(&commandLineOpts, &environmentOpts, &configOpts)
+
+	expectedSources := []string{
+		"command line",
+		"environment",
+		"channel profile prod",
+		"config file .sad.json",
+		"default",
+	}
+
+	if len(layers) != len(expectedSources) {
+		t.Fatalf("Expected %d layers but got %d", len(expectedSources), len(layers))
+	}
+
+	for i, layer := range layers {
+		testutils.CompareStrings("layer source", expectedSources[i], layer.Source, t)
+	}
+
+	main.MergeOptionsHierarchy(&commandLineOpts, &environmentOpts, &configOpts)
+
+	testutils.CompareStrings("layer root directory", "", layers[0].Options.RootDir, t)
+}
+
 func TestParseFlags(t *testing.T) {
 	testOpts := testutils.GetTestOpts()
 	stringTestOpts := testutils.StringOptions{}
@@ -107,6 +423,8 @@ func TestParseFlags(t *testing.T) {
 		t.Errorf("Expected empty output but got: %s", output)
 	}
 
+	testOpts.RegistryPassword = ""
+
 	testutils.CompareOpts(testOpts, *opts, t)
 }
 
@@ -132,10 +450,15 @@ func buildArgs(stringOpts *testutils.StringOptions) []string {
 	args := []string{
 		"-registry",
 		stringOpts.Registry,
+		"-registry-username",
+		stringOpts.RegistryUsername,
+		"-registry-logout",
 		"-image",
 		stringOpts.Image,
 		"-digest",
 		stringOpts.Digest,
+		"-tag",
+		stringOpts.Tag,
 		"-server",
 		stringOpts.Server,
 		"-username",
@@ -148,6 +471,19 @@ func buildArgs(stringOpts *testutils.StringOptions) []string {
 		stringOpts.Channel,
 		"-env-vars",
 		stringOpts.EnvVars,
+		"-env-files",
+		stringOpts.EnvFiles,
+		"-secret-vars",
+		stringOpts.SecretVars,
+		"-compose-files",
+		stringOpts.ComposeFiles,
+		"-sync",
+		stringOpts.Sync,
+		"-lock-timeout",
+		stringOpts.LockTimeout,
+		"-history-retention",
+		stringOpts.HistoryRetention,
+		"-template",
 		"-debug",
 	}
 
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jswny/sad"
+	"golang.org/x/term"
+)
+
+// watchTerminalResize sends the new size of the terminal with the specified file descriptor whenever it is resized, until the returned function is called.
+func watchTerminalResize(fd int) (<-chan sad.TerminalSize, func()) {
+	signals := make(chan os.Signal, 1)
+	resize := make(chan sad.TerminalSize, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				width, height, err := term.GetSize(fd)
+
+				if err != nil {
+					continue
+				}
+
+				select {
+				case resize <- sad.TerminalSize{Width: width, Height: height}:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(signals)
+		close(done)
+	}
+
+	return resize, stop
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"github.com/jswny/sad"
+)
+
+// watchTerminalResize does nothing on Windows, which has no signal for terminal resizes, so the remote terminal keeps its initial size.
+func watchTerminalResize(fd int) (<-chan sad.TerminalSize, func()) {
+	return make(chan sad.TerminalSize), func() {}
+}
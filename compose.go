@@ -0,0 +1,426 @@
+package sad
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// GeneratedEnvVarNames are the names of the variables which Sad always generates in the .env file.
+var GeneratedEnvVarNames = []string{
+	"IMAGE",
+	"IMAGE_DIGEST",
+	"IMAGE_TAG",
+	"CONTAINER_NAME",
+}
+
+// composeInterpolationRegexp matches variable references in Docker Compose files, such as $FOO, ${FOO}, ${FOO:-default}, or an escaped $$.
+// The name is in the second or third group, and the modifier of a braced reference is in the fourth group.
+var composeInterpolationRegexp = regexp.MustCompile(`\$(?:(\$)|([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)(:?[-?+][^}]*)?\})`)
+
+// ComposeFile is a local Docker Compose file for the deployment, along with the name it is sent to the server with.
+type ComposeFile struct {
+	LocalPath  string
+	RemoteName string
+}
+
+// ChannelComposeFileName gets the name of the local Docker Compose override file for the specified channel, such as ".sad.docker-compose.prod.yml".
+func ChannelComposeFileName(channel string) string {
+	extension := filepath.Ext(LocalDockerComposeFileName)
+
+	return strings.TrimSuffix(LocalDockerComposeFileName, extension) + "." + channel + extension
+}
+
+// FindComposeFiles finds the Docker Compose files for the deployment, in the order in which they should be merged.
+// If the ComposeFiles field is set, those files are used, relative to the provided path.
+// Otherwise, the Docker Compose file (see LocalDockerComposeFileName) is found recursively under the provided path, followed by the override file for the channel next to it if it exists (see ChannelComposeFileName).
+// The first file is sent to the server as RemoteDockerComposeFileName, and the others keep their names without the leading ".sad." so that each of them is preserved.
+// Returns an error if a file does not exist, or if two files would be sent with the same name.
+func FindComposeFiles(fromPath string, opts *Options) ([]ComposeFile, error) {
+	var localPaths []string
+
+	if len(opts.ComposeFiles) != 0 {
+		for _, composeFile := range opts.ComposeFiles {
+			localPath := filepath.Join(fromPath, composeFile)
+
+			if _, err := os.Stat(localPath); err != nil {
+				return nil, fmt.Errorf("error finding Docker Compose file \"%s\": %s", localPath, err)
+			}
+
+			localPaths = append(localPaths, localPath)
+		}
+	} else {
+		localPath, err := FindFilePathRecursive(fromPath, LocalDockerComposeFileName)
+
+		if err != nil {
+			return nil, fmt.Errorf("error finding file \"%s\" under path \"%s\": %s", LocalDockerComposeFileName, fromPath, err)
+		}
+
+		localPaths = append(localPaths, localPath)
+
+		if opts.Channel != "" {
+			overridePath := filepath.Join(filepath.Dir(localPath), ChannelComposeFileName(opts.Channel))
+
+			if _, err := os.Stat(overridePath); err == nil {
+				localPaths = append(localPaths, overridePath)
+			}
+		}
+	}
+
+	composeFiles := make([]ComposeFile, len(localPaths))
+	remoteNames := make(map[string]string)
+
+	for i, localPath := range localPaths {
+		remoteName := RemoteDockerComposeFileName
+
+		if i != 0 {
+			remoteName = strings.TrimPrefix(filepath.Base(localPath), ".sad.")
+
+			if isReservedRemotePath(remoteName) {
+				return nil, fmt.Errorf("Docker Compose file \"%s\" would be sent as \"%s\", which is reserved for files generated by Sad", localPath, remoteName)
+			}
+		}
+
+		if existing, ok := remoteNames[remoteName]; ok {
+			return nil, fmt.Errorf("Docker Compose files \"%s\" and \"%s\" would both be sent as \"%s\"", existing, localPath, remoteName)
+		}
+
+		remoteNames[remoteName] = localPath
+
+		composeFiles[i] = ComposeFile{
+			LocalPath:  localPath,
+			RemoteName: remoteName,
+		}
+	}
+
+	return composeFiles, nil
+}
+
+// GetComposeCommand gets the Docker Compose command with the specified arguments, which uses each of the Docker Compose files on the server in order.
+// Each file is always passed explicitly, even if there is only one, so that Docker Compose never picks up other files on the server such as docker-compose.override.yml.
+func GetComposeCommand(composeFiles []ComposeFile, args string) string {
+	cmd := "docker-compose"
+
+	for _, composeFile := range composeFiles {
+		cmd += " -f " + shellQuote(composeFile.RemoteName)
+	}
+
+	return cmd + " " + args
+}
+
+// GetComposeRunCommand gets the Docker Compose command which runs the specified command for a service in the deployment directory on the server, without allocating a TTY.
+// If exec is set, the command runs in the running container of the service, otherwise it runs in a new container which is removed afterwards.
+// Each of the arguments of the command is quoted, so that they are passed through as they are.
+func GetComposeRunCommand(remotePath string, composeFiles []ComposeFile, service string, exec bool, command []string) string {
+	args := "run --rm -T"
+
+	if exec {
+		args = "exec -T"
+	}
+
+	args += " " + shellQuote(service)
+
+	for _, arg := range command {
+		args += " " + shellQuote(arg)
+	}
+
+	return fmt.Sprintf("cd %s && %s", shellQuote(remotePath), GetComposeCommand(composeFiles, args))
+}
+
+// ValidateComposeFiles validates the Docker Compose files in the reader map for deployment (see GetEntitiesForDeployment) before they are sent to the server.
+// The files are merged in order, and one of the services must use the image "${IMAGE}" with the container name "${CONTAINER_NAME}".
+// Every variable referenced by the files without a default value must be set in the generated .env file.
+// The Docker Compose files and the .env file are read into memory, and their readers are replaced so that they can still be sent.
+// Returns the names of the variables in the .env file which are not referenced by any of the files (except for GeneratedEnvVarNames), or an error describing all of the problems.
+func ValidateComposeFiles(readerMap map[string]io.Reader, composeFiles []ComposeFile) ([]string, error) {
+	dotEnv, err := readAndReplace(readerMap, RemoteDotEnvFileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	envNames := getDotEnvNames(dotEnv)
+
+	var problems []string
+	services := make(map[string]map[interface{}]interface{})
+	referenced := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	for _, composeFile := range composeFiles {
+		content, err := readAndReplace(readerMap, composeFile.RemoteName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var parsed map[interface{}]interface{}
+
+		if err := yaml.Unmarshal(content, &parsed); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is not valid YAML: %s", composeFile.LocalPath, err))
+			continue
+		}
+
+		for name, modifier := range getComposeVariableReferences(parsed) {
+			referenced[name] = true
+
+			hasDefault := strings.HasPrefix(modifier, "-") || strings.HasPrefix(modifier, ":-") || strings.HasPrefix(modifier, "+") || strings.HasPrefix(modifier, ":+")
+
+			if !envNames[name] && !hasDefault {
+				missing[name] = true
+			}
+		}
+
+		mergeComposeServices(services, parsed)
+	}
+
+	problems = append(problems, checkComposeServices(services)...)
+
+	for _, name := range sortedKeys(missing) {
+		problems = append(problems, fmt.Sprintf("variable %s is referenced but not set in the .env file", name))
+	}
+
+	if len(problems) != 0 {
+		return nil, fmt.Errorf("invalid Docker Compose files! %s", strings.Join(problems, ", "))
+	}
+
+	var unused []string
+
+	for _, name := range sortedKeys(envNames) {
+		if !referenced[name] && !isGeneratedEnvVarName(name) {
+			unused = append(unused, name)
+		}
+	}
+
+	return unused, nil
+}
+
+// FindImageService finds the name of the service which uses the image "${IMAGE}" after merging the local Docker Compose files in order.
+// The files are rendered as templates first if the Template field of the options is set.
+// Returns an error if the files can't be parsed, or if there isn't exactly one such service.
+func FindImageService(composeFiles []ComposeFile, opts *Options) (string, error) {
+	var templateData *TemplateData
+
+	if opts.Template {
+		var err error
+		templateData, err = GetTemplateData(opts)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	services := make(map[string]map[interface{}]interface{})
+
+	for _, composeFile := range composeFiles {
+		file, err := os.Open(composeFile.LocalPath)
+
+		if err != nil {
+			return "", fmt.Errorf("error opening Docker Compose file %s: %s", composeFile.LocalPath, err)
+		}
+
+		var reader io.Reader = file
+
+		if templateData != nil {
+			reader, err = RenderTemplate(filepath.Base(composeFile.LocalPath), file, templateData)
+		}
+
+		var content []byte
+
+		if err == nil {
+			content, err = ioutil.ReadAll(reader)
+		}
+
+		file.Close()
+
+		if err != nil {
+			return "", fmt.Errorf("error reading Docker Compose file %s: %s", composeFile.LocalPath, err)
+		}
+
+		var parsed map[interface{}]interface{}
+
+		if err := yaml.Unmarshal(content, &parsed); err != nil {
+			return "", fmt.Errorf("%s is not valid YAML: %s", composeFile.LocalPath, err)
+		}
+
+		mergeComposeServices(services, parsed)
+	}
+
+	imageServices := getImageServiceNames(services)
+
+	if len(imageServices) != 1 {
+		return "", fmt.Errorf("expected one service to use the image \"${IMAGE}\" but found %d", len(imageServices))
+	}
+
+	return imageServices[0], nil
+}
+
+// mergeComposeServices merges the services of a parsed Docker Compose file into the services merged so far, overriding their top-level keys.
+func mergeComposeServices(services map[string]map[interface{}]interface{}, parsed map[interface{}]interface{}) {
+	fileServices, _ := parsed["services"].(map[interface{}]interface{})
+
+	for name, service := range fileServices {
+		serviceName := fmt.Sprint(name)
+		serviceMap, _ := service.(map[interface{}]interface{})
+
+		if services[serviceName] == nil {
+			services[serviceName] = make(map[interface{}]interface{})
+		}
+
+		for key, value := range serviceMap {
+			services[serviceName][key] = value
+		}
+	}
+}
+
+// getImageServiceNames gets the names of the services which use the image "${IMAGE}", sorted.
+func getImageServiceNames(services map[string]map[interface{}]interface{}) []string {
+	var imageServices []string
+
+	for _, name := range sortedServiceNames(services) {
+		if isComposeVariable(services[name]["image"], "IMAGE") {
+			imageServices = append(imageServices, name)
+		}
+	}
+
+	return imageServices
+}
+
+func checkComposeServices(services map[string]map[interface{}]interface{}) []string {
+	var problems []string
+
+	imageServices := getImageServiceNames(services)
+
+	for _, name := range imageServices {
+		if !isComposeVariable(services[name]["container_name"], "CONTAINER_NAME") {
+			problems = append(problems, fmt.Sprintf("service %s uses the image \"${IMAGE}\" but not the container name \"${CONTAINER_NAME}\"", name))
+		}
+	}
+
+	if len(imageServices) == 0 {
+		problems = append(problems, "no service uses the image \"${IMAGE}\"")
+	} else if len(imageServices) > 1 {
+		problems = append(problems, fmt.Sprintf("services %s all use the image \"${IMAGE}\" but container names must be unique", strings.Join(imageServices, ", ")))
+	}
+
+	return problems
+}
+
+// getComposeVariableReferences gets the variables referenced by all of the string values in the parsed Docker Compose file, mapped to their modifiers, such as ":-default".
+func getComposeVariableReferences(value interface{}) map[string]string {
+	references := make(map[string]string)
+
+	var walk func(value interface{})
+
+	walk = func(value interface{}) {
+		switch typed := value.(type) {
+		case string:
+			for _, match := range composeInterpolationRegexp.FindAllStringSubmatch(typed, -1) {
+				if match[1] != "" {
+					continue
+				}
+
+				name := match[2] + match[3]
+
+				if modifier, ok := references[name]; !ok || modifier != "" {
+					references[name] = match[4]
+				}
+			}
+		case map[interface{}]interface{}:
+			for _, nested := range typed {
+				walk(nested)
+			}
+		case []interface{}:
+			for _, nested := range typed {
+				walk(nested)
+			}
+		}
+	}
+
+	walk(value)
+
+	return references
+}
+
+func isComposeVariable(value interface{}, name string) bool {
+	s, ok := value.(string)
+
+	return ok && (s == "${"+name+"}" || s == "$"+name)
+}
+
+func isGeneratedEnvVarName(name string) bool {
+	for _, generatedName := range GeneratedEnvVarNames {
+		if name == generatedName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getDotEnvNames gets the names of the variables in a .env file generated by GenerateDotEnvFile.
+func getDotEnvNames(content []byte) map[string]bool {
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		separatorIndex := strings.Index(line, "=")
+
+		if separatorIndex > 0 && dotEnvNameRegexp.MatchString(line[:separatorIndex]) {
+			names[line[:separatorIndex]] = true
+		}
+	}
+
+	return names
+}
+
+func readAndReplace(readerMap map[string]io.Reader, name string) ([]byte, error) {
+	reader, ok := readerMap[name]
+
+	if !ok {
+		return nil, fmt.Errorf("%s is not one of the files for deployment", name)
+	}
+
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", name, err)
+	}
+
+	readerMap[name] = bytes.NewReader(content)
+
+	return content, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func sortedServiceNames(services map[string]map[interface{}]interface{}) []string {
+	names := make([]string, 0, len(services))
+
+	for name := range services {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
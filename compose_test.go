@@ -0,0 +1,358 @@
+package sad_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestChannelComposeFileName(t *testing.T) {
+	testutils.CompareStrings("file name", ".sad.docker-compose.prod.yml", sad.ChannelComposeFileName("prod"), t)
+}
+
+func TestFindComposeFiles(t *testing.T) {
+	tempDirPath := createComposeTestDir(t, sad.LocalDockerComposeFileName, ".sad.docker-compose.prod.yml")
+	defer os.RemoveAll(tempDirPath)
+
+	opts := &sad.Options{
+		Channel: "prod",
+	}
+
+	composeFiles, err := sad.FindComposeFiles(tempDirPath, opts)
+
+	if err != nil {
+		t.Fatalf("Error finding Docker Compose files: %s", err)
+	}
+
+	expected := []sad.ComposeFile{
+		{LocalPath: filepath.Join(tempDirPath, sad.LocalDockerComposeFileName), RemoteName: sad.RemoteDockerComposeFileName},
+		{LocalPath: filepath.Join(tempDirPath, ".sad.docker-compose.prod.yml"), RemoteName: "docker-compose.prod.yml"},
+	}
+
+	compareComposeFiles(expected, composeFiles, t)
+}
+
+func TestFindComposeFilesNoOverride(t *testing.T) {
+	tempDirPath := createComposeTestDir(t, sad.LocalDockerComposeFileName, ".sad.docker-compose.prod.yml")
+	defer os.RemoveAll(tempDirPath)
+
+	opts := &sad.Options{
+		Channel: "beta",
+	}
+
+	composeFiles, err := sad.FindComposeFiles(tempDirPath, opts)
+
+	if err != nil {
+		t.Fatalf("Error finding Docker Compose files: %s", err)
+	}
+
+	expected := []sad.ComposeFile{
+		{LocalPath: filepath.Join(tempDirPath, sad.LocalDockerComposeFileName), RemoteName: sad.RemoteDockerComposeFileName},
+	}
+
+	compareComposeFiles(expected, composeFiles, t)
+}
+
+func TestFindComposeFilesExplicit(t *testing.T) {
+	tempDirPath := createComposeTestDir(t, "base.yml", "overrides/prod.yml")
+	defer os.RemoveAll(tempDirPath)
+
+	opts := &sad.Options{
+		Channel:      "prod",
+		ComposeFiles: []string{"base.yml", "overrides/prod.yml"},
+	}
+
+	composeFiles, err := sad.FindComposeFiles(tempDirPath, opts)
+
+	if err != nil {
+		t.Fatalf("Error finding Docker Compose files: %s", err)
+	}
+
+	expected := []sad.ComposeFile{
+		{LocalPath: filepath.Join(tempDirPath, "base.yml"), RemoteName: sad.RemoteDockerComposeFileName},
+		{LocalPath: filepath.Join(tempDirPath, "overrides", "prod.yml"), RemoteName: "prod.yml"},
+	}
+
+	compareComposeFiles(expected, composeFiles, t)
+}
+
+func TestFindComposeFilesInvalid(t *testing.T) {
+	tempDirPath := createComposeTestDir(t, "base.yml", "a/prod.yml", "b/prod.yml", ".env")
+	defer os.RemoveAll(tempDirPath)
+
+	invalid := map[string][]string{
+		"missing":   {"base.yml", "missing.yml"},
+		"duplicate": {"base.yml", "a/prod.yml", "b/prod.yml"},
+		"reserved":  {"base.yml", ".env"},
+	}
+
+	for name, composeFiles := range invalid {
+		opts := &sad.Options{
+			ComposeFiles: composeFiles,
+		}
+
+		_, err := sad.FindComposeFiles(tempDirPath, opts)
+
+		if err == nil {
+			t.Errorf("Expected error finding %s Docker Compose files but got nil", name)
+		}
+	}
+}
+
+func TestGetComposeCommand(t *testing.T) {
+	composeFiles := []sad.ComposeFile{
+		{RemoteName: sad.RemoteDockerComposeFileName},
+	}
+
+	testutils.CompareStrings("command", "docker-compose -f 'docker-compose.yml' up -d", sad.GetComposeCommand(composeFiles, "up -d"), t)
+
+	composeFiles = append(composeFiles, sad.ComposeFile{RemoteName: "docker-compose.prod.yml"})
+
+	expected := "docker-compose -f 'docker-compose.yml' -f 'docker-compose.prod.yml' pull"
+
+	testutils.CompareStrings("command", expected, sad.GetComposeCommand(composeFiles, "pull"), t)
+}
+
+func TestGetEntitiesForDeploymentComposeOverride(t *testing.T) {
+	tempDirPath := createComposeTestDir(t, sad.LocalDockerComposeFileName, ".sad.docker-compose.prod.yml")
+	defer os.RemoveAll(tempDirPath)
+
+	opts := &sad.Options{
+		Image:   "user/repo",
+		Digest:  "abc123",
+		Channel: "prod",
+	}
+
+	composeFiles := findComposeFiles(tempDirPath, opts, t)
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, composeFiles, getDeploymentEnv(composeFiles, opts, t), opts)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
+	if err != nil {
+		t.Fatalf("Error getting files for deployment: %s", err)
+	}
+
+	expected := map[string]string{
+		sad.RemoteDockerComposeFileName: sad.LocalDockerComposeFileName,
+		"docker-compose.prod.yml":       ".sad.docker-compose.prod.yml",
+	}
+
+	for remoteName, content := range expected {
+		testutils.CompareStrings(remoteName, content, testutils.ReadFromReader(remoteName, readerMap[remoteName], t), t)
+	}
+}
+
+func TestValidateComposeFiles(t *testing.T) {
+	base := `version: "3"
+services:
+  app:
+    image: "${IMAGE}"
+    container_name: app
+    environment:
+      - FOO=${FOO}
+      - BAR=${BAR:-default}
+      - PRICE=$$5
+  db:
+    image: postgres
+`
+	override := `services:
+  app:
+    container_name: "${CONTAINER_NAME}"
+    labels:
+      - "baz=$BAZ"
+`
+
+	readerMap := map[string]io.Reader{
+		sad.RemoteDockerComposeFileName: strings.NewReader(base),
+		"docker-compose.prod.yml":       strings.NewReader(override),
+		sad.RemoteDotEnvFileName:        sad.GenerateDotEnvFile(map[string]string{"FOO": "foo", "BAZ": "baz", "UNUSED": "unused", "IMAGE": "user/repo@abc123", "CONTAINER_NAME": "user-repo-prod"}),
+	}
+
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: sad.LocalDockerComposeFileName, RemoteName: sad.RemoteDockerComposeFileName},
+		{LocalPath: ".sad.docker-compose.prod.yml", RemoteName: "docker-compose.prod.yml"},
+	}
+
+	unused, err := sad.ValidateComposeFiles(readerMap, composeFiles)
+
+	if err != nil {
+		t.Fatalf("Error validating Docker Compose files: %s", err)
+	}
+
+	testutils.CompareStrings("unused variables", "UNUSED", strings.Join(unused, ","), t)
+
+	testutils.CompareStrings("Docker Compose file", base, testutils.ReadFromReader("Docker Compose file", readerMap[sad.RemoteDockerComposeFileName], t), t)
+}
+
+func TestValidateComposeFilesInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"no image":             "services:\n  app:\n    image: user/repo\n    container_name: \"${CONTAINER_NAME}\"\n",
+		"wrong container name": "services:\n  app:\n    image: \"${IMAGE}\"\n    container_name: app\n",
+		"multiple images":      "services:\n  a:\n    image: \"${IMAGE}\"\n    container_name: \"${CONTAINER_NAME}\"\n  b:\n    image: \"${IMAGE}\"\n    container_name: \"${CONTAINER_NAME}\"\n",
+		"missing variable":     "services:\n  app:\n    image: \"${IMAGE}\"\n    container_name: \"${CONTAINER_NAME}\"\n    environment:\n      - MISSING=${MISSING}\n",
+		"required variable":    "services:\n  app:\n    image: \"${IMAGE}\"\n    container_name: \"${CONTAINER_NAME}\"\n    environment:\n      - MISSING=${MISSING:?required}\n",
+		"invalid YAML":         "services: [\n",
+	}
+
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: sad.LocalDockerComposeFileName, RemoteName: sad.RemoteDockerComposeFileName},
+	}
+
+	for name, content := range invalid {
+		readerMap := map[string]io.Reader{
+			sad.RemoteDockerComposeFileName: strings.NewReader(content),
+			sad.RemoteDotEnvFileName:        sad.GenerateDotEnvFile(map[string]string{"IMAGE": "user/repo@abc123", "CONTAINER_NAME": "user-repo-beta"}),
+		}
+
+		_, err := sad.ValidateComposeFiles(readerMap, composeFiles)
+
+		if err == nil {
+			t.Errorf("Expected error validating Docker Compose file with %s but got nil", name)
+		}
+	}
+}
+
+func TestValidateComposeFilesMissingVariableMessage(t *testing.T) {
+	content := "services:\n  app:\n    image: \"${IMAGE}\"\n    container_name: \"${CONTAINER_NAME}\"\n    environment:\n      - FOO=${FOO}\n"
+
+	readerMap := map[string]io.Reader{
+		sad.RemoteDockerComposeFileName: strings.NewReader(content),
+		sad.RemoteDotEnvFileName:        sad.GenerateDotEnvFile(map[string]string{"IMAGE": "user/repo@abc123", "CONTAINER_NAME": "user-repo-beta"}),
+	}
+
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: sad.LocalDockerComposeFileName, RemoteName: sad.RemoteDockerComposeFileName},
+	}
+
+	_, err := sad.ValidateComposeFiles(readerMap, composeFiles)
+
+	if err == nil || !strings.Contains(err.Error(), "variable FOO is referenced but not set in the .env file") {
+		t.Errorf("Expected error about the missing variable but got: %v", err)
+	}
+}
+
+func TestGetComposeRunCommand(t *testing.T) {
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: sad.LocalDockerComposeFileName, RemoteName: sad.RemoteDockerComposeFileName},
+	}
+
+	cmd := sad.GetComposeRunCommand("/srv/foo-beta", composeFiles, "app", false, []string{"rake", "db:migrate", "it's"})
+
+	expected := "cd '/srv/foo-beta' && docker-compose -f 'docker-compose.yml' run --rm -T 'app' 'rake' 'db:migrate' 'it'\"'\"'s'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+
+	composeFiles = append(composeFiles, sad.ComposeFile{LocalPath: ".sad.docker-compose.prod.yml", RemoteName: "docker-compose.prod.yml"})
+
+	cmd = sad.GetComposeRunCommand("/srv/foo-prod", composeFiles, "app", true, []string{"ls"})
+
+	expected = "cd '/srv/foo-prod' && docker-compose -f 'docker-compose.yml' -f 'docker-compose.prod.yml' exec -T 'app' 'ls'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestFindImageService(t *testing.T) {
+	tempDirPath := createComposeTestDir(t)
+	defer os.RemoveAll(tempDirPath)
+
+	base := "services:\n  web:\n    image: \"${IMAGE}\"\n  db:\n    image: postgres\n"
+	override := "services:\n  web:\n    image: nginx\n  app:\n    image: \"${IMAGE}\"\n    container_name: \"${CONTAINER_NAME}\"\n"
+
+	basePath := filepath.Join(tempDirPath, sad.LocalDockerComposeFileName)
+	overridePath := filepath.Join(tempDirPath, ".sad.docker-compose.prod.yml")
+
+	if err := ioutil.WriteFile(basePath, []byte(base), 0644); err != nil {
+		t.Fatalf("Error writing Docker Compose file: %s", err)
+	}
+
+	if err := ioutil.WriteFile(overridePath, []byte(override), 0644); err != nil {
+		t.Fatalf("Error writing Docker Compose file: %s", err)
+	}
+
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: basePath, RemoteName: sad.RemoteDockerComposeFileName},
+		{LocalPath: overridePath, RemoteName: "docker-compose.prod.yml"},
+	}
+
+	opts := testutils.GetTestOpts()
+
+	service, err := sad.FindImageService(composeFiles, &opts)
+
+	if err != nil {
+		t.Fatalf("Error finding image service: %s", err)
+	}
+
+	testutils.CompareStrings("service", "app", service, t)
+
+	service, err = sad.FindImageService(composeFiles[:1], &opts)
+
+	if err != nil {
+		t.Fatalf("Error finding image service: %s", err)
+	}
+
+	testutils.CompareStrings("service", "web", service, t)
+
+	if err := ioutil.WriteFile(overridePath, []byte("services:\n  web:\n    image: nginx\n"), 0644); err != nil {
+		t.Fatalf("Error writing Docker Compose file: %s", err)
+	}
+
+	_, err = sad.FindImageService(composeFiles, &opts)
+
+	if err == nil {
+		t.Errorf("Expected error finding image service without one but got nil")
+	}
+}
+
+// createComposeTestDir creates a temp dir with each of the files, containing their own path.
+func createComposeTestDir(t *testing.T, filePaths ...string) string {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	for _, filePath := range filePaths {
+		fullPath := filepath.Join(tempDirPath, filepath.FromSlash(filePath))
+
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Error creating temp dir for \"%s\", %s", fullPath, err)
+		}
+
+		if err := ioutil.WriteFile(fullPath, []byte(filePath), 0644); err != nil {
+			t.Fatalf("Error writing to temp file \"%s\", %s", fullPath, err)
+		}
+	}
+
+	return tempDirPath
+}
+
+func findComposeFiles(fromPath string, opts *sad.Options, t *testing.T) []sad.ComposeFile {
+	composeFiles, err := sad.FindComposeFiles(fromPath, opts)
+
+	if err != nil {
+		t.Fatalf("Error finding Docker Compose files: %s", err)
+	}
+
+	return composeFiles
+}
+
+func compareComposeFiles(expected []sad.ComposeFile, actual []sad.ComposeFile, t *testing.T) {
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected %d Docker Compose files but got %d: %v", len(expected), len(actual), actual)
+	}
+
+	for i := range expected {
+		testutils.CompareStrings("local path", expected[i].LocalPath, actual[i].LocalPath, t)
+		testutils.CompareStrings("remote name", expected[i].RemoteName, actual[i].RemoteName, t)
+	}
+}
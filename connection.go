@@ -2,8 +2,12 @@ package sad
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"path"
+	"sort"
+	"strings"
 
 	scp "github.com/bramvdbogaerde/go-scp"
 	"golang.org/x/crypto/ssh"
@@ -12,17 +16,78 @@ import (
 // SendFiles sends the specified reader interfaces as files to a server using the provided SSH client.
 // The files are specified as a map of the name of the file to send to the server to a reader which can read the file.
 // The full path name for the file on the remote server will be generatd as <root directory as specified by options>/<app name with channel>/<file name>.
+// File names may contain subdirectories, which are created as needed, but they must stay inside the deployment directory (see ValidateRemoteRelativePath).
+// Files are sent with permissions 0644, unless their reader is a PermissionedReader, in which case any existing file is removed first so that the permissions are applied.
+// If any of the files are under RemoteSecretsDirName, that directory is recreated first so that previous secret files are removed.
+// The remote manifest (see RemoteManifestFileName) is removed first, since it would no longer describe the files on the server, so the next sync sends all of the files.
 func SendFiles(sshClient *ssh.Client, opts *Options, files map[string]io.Reader) error {
-	for fileName, reader := range files {
-		deploymentName, err := opts.GetDeploymentName()
+	deploymentName, err := opts.GetDeploymentName()
 
-		if err != nil {
-			return fmt.Errorf("error getting full app name: %s", err)
+	if err != nil {
+		return fmt.Errorf("error getting full app name: %s", err)
+	}
+
+	deploymentPath := fmt.Sprintf("%s/%s", opts.RootDir, deploymentName)
+
+	hasSecretFiles := false
+	dirPaths := make(map[string]bool)
+	var permissionedPaths []string
+
+	for fileName := range files {
+		if err := ValidateRemoteRelativePath(fileName); err != nil {
+			return fmt.Errorf("error sending file: %s", err)
 		}
 
-		remotePath := fmt.Sprintf("%s/%s/%s", opts.RootDir, deploymentName, fileName)
+		if isSecretFile(fileName) {
+			hasSecretFiles = true
+			continue
+		}
+
+		if dir := path.Dir(fileName); dir != "." {
+			dirPaths[deploymentPath+"/"+dir] = true
+		}
+
+		if _, ok := files[fileName].(PermissionedReader); ok {
+			permissionedPaths = append(permissionedPaths, deploymentPath+"/"+fileName)
+		}
+	}
+
+	if _, err := SSHRunCommand(sshClient, GetRemoveFilesCommand([]string{deploymentPath + "/" + RemoteManifestFileName})); err != nil {
+		return fmt.Errorf("error removing manifest: %s", err)
+	}
+
+	if hasSecretFiles {
+		cmd := GetRecreateSecretsDirCommand(deploymentPath + "/" + RemoteSecretsDirName)
+
+		if _, err := SSHRunCommand(sshClient, cmd); err != nil {
+			return fmt.Errorf("error creating secrets directory: %s", err)
+		}
+	}
+
+	if len(dirPaths) != 0 {
+		if _, err := SSHRunCommand(sshClient, GetMakeDirsCommand(dirPaths)); err != nil {
+			return fmt.Errorf("error creating directories for files: %s", err)
+		}
+	}
+
+	// Existing files keep their permissions when they are overwritten, and read-only files cannot be overwritten at all.
+	if len(permissionedPaths) != 0 {
+		sort.Strings(permissionedPaths)
+
+		if _, err := SSHRunCommand(sshClient, GetRemoveFilesCommand(permissionedPaths)); err != nil {
+			return fmt.Errorf("error replacing files with permissions: %s", err)
+		}
+	}
+
+	for fileName, reader := range files {
+		remotePath := fmt.Sprintf("%s/%s", deploymentPath, fileName)
 
 		permissions := "0644"
+
+		if permissionedReader, ok := reader.(PermissionedReader); ok {
+			permissions = permissionedReader.Permissions()
+		}
+
 		err = copyFile(fileName, reader, remotePath, permissions, sshClient)
 
 		if err != nil {
@@ -53,6 +118,13 @@ func GetSSHClientConfig(opts *Options) (*ssh.ClientConfig, error) {
 // SSHRunCommand Runs the specified command via SSH given the specified client.
 // Returns the output of the command, or an error.
 func SSHRunCommand(client *ssh.Client, cmd string) (string, error) {
+	return SSHRunCommandWithStdin(client, cmd, nil)
+}
+
+// SSHRunCommandWithStdin runs the specified command via SSH given the specified client, feeding the reader to the standard input of the command.
+// This should be used to pass secrets to commands so that they do not appear in the command line.
+// Returns the output of the command, or an error.
+func SSHRunCommandWithStdin(client *ssh.Client, cmd string, stdin io.Reader) (string, error) {
 	session, err := client.NewSession()
 
 	if err != nil {
@@ -63,6 +135,7 @@ func SSHRunCommand(client *ssh.Client, cmd string) (string, error) {
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
+	session.Stdin = stdin
 	session.Stdout = &stdout
 	session.Stderr = &stderr
 
@@ -77,6 +150,134 @@ func SSHRunCommand(client *ssh.Client, cmd string) (string, error) {
 	return output, nil
 }
 
+// SSHStreamCommand runs the specified command via SSH given the specified client, streaming its output to the writers as it is produced.
+// If the reader is not nil, it is copied to the standard input of the command until it is exhausted, but the command does not wait for it to be.
+// Returns the exit status of the command, or an error if the command could not be run or exited without a status, such as from a signal.
+func SSHStreamCommand(client *ssh.Client, cmd string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	session, err := client.NewSession()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if stdin != nil {
+		stdinPipe, err := session.StdinPipe()
+
+		if err != nil {
+			return 0, err
+		}
+
+		go func() {
+			io.Copy(stdinPipe, stdin)
+			stdinPipe.Close()
+		}()
+	}
+
+	err = session.Run(cmd)
+
+	var exitError *ssh.ExitError
+
+	if errors.As(err, &exitError) {
+		return exitError.ExitStatus(), nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute command \"%s\" via SSH client: %s", cmd, err)
+	}
+
+	return 0, nil
+}
+
+// TerminalSize is the size of a terminal in characters.
+type TerminalSize struct {
+	Width  int
+	Height int
+}
+
+// SSHRunInteractiveCommand runs the specified command via SSH given the specified client in a pseudo-terminal of the specified type and size, connected to the provided reader and writers.
+// Each size received from the resize channel is sent to the server so that the pseudo-terminal follows the size of the local terminal.
+// Returns the exit status of the command, or an error if the command could not be run or exited without a status.
+func SSHRunInteractiveCommand(client *ssh.Client, cmd string, terminal string, size TerminalSize, resize <-chan TerminalSize, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	session, err := client.NewSession()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+
+	if err := session.RequestPty(terminal, size.Height, size.Width, modes); err != nil {
+		return 0, fmt.Errorf("failed to request pseudo-terminal: %s", err)
+	}
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	stdinPipe, err := session.StdinPipe()
+
+	if err != nil {
+		return 0, err
+	}
+
+	go func() {
+		io.Copy(stdinPipe, stdin)
+		stdinPipe.Close()
+	}()
+
+	if err := session.Start(cmd); err != nil {
+		return 0, fmt.Errorf("failed to start command \"%s\" via SSH client: %s", cmd, err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case size := <-resize:
+				session.WindowChange(size.Height, size.Width)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = session.Wait()
+
+	var exitError *ssh.ExitError
+
+	if errors.As(err, &exitError) {
+		return exitError.ExitStatus(), nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute command \"%s\" via SSH client: %s", cmd, err)
+	}
+
+	return 0, nil
+}
+
+// GetShellCommand gets the command which opens an interactive shell for the deployment on the server.
+// If host is set, the shell is the login shell of the user on the server in the deployment directory, otherwise the specified shell runs in the deployment container.
+func GetShellCommand(remotePath string, containerName string, shell string, host bool) string {
+	if host {
+		return fmt.Sprintf("cd %s && exec \"${SHELL:-sh}\" -l", shellQuote(remotePath))
+	}
+
+	return fmt.Sprintf("docker exec -it %s %s", shellQuote(containerName), shellQuote(shell))
+}
+
 func copyFile(fileName string, reader io.Reader, remotePath string, permissions string, sshClient *ssh.Client) error {
 	client, err := scp.NewClientBySSH(sshClient)
 
@@ -94,3 +295,48 @@ func copyFile(fileName string, reader io.Reader, remotePath string, permissions
 
 	return nil
 }
+
+// PermissionedReader is a reader for a file which should be sent to the server with specific permissions, see SendFiles.
+type PermissionedReader interface {
+	io.Reader
+	Permissions() string
+}
+
+// NewPermissionedReader wraps a reader so that the file it reads is sent with the specified octal permissions, such as "0600".
+func NewPermissionedReader(reader io.Reader, permissions string) PermissionedReader {
+	return &permissionedReader{
+		Reader:      reader,
+		permissions: permissions,
+	}
+}
+
+// GetMakeDirsCommand gets the command which creates each of the directories at the specified paths on the server, along with their parents.
+func GetMakeDirsCommand(dirPaths map[string]bool) string {
+	quotedPaths := make([]string, 0, len(dirPaths))
+
+	for dirPath := range dirPaths {
+		quotedPaths = append(quotedPaths, shellQuote(dirPath))
+	}
+
+	sort.Strings(quotedPaths)
+
+	return "mkdir -p " + strings.Join(quotedPaths, " ")
+}
+
+// GetRecreateSecretsDirCommand gets the command which removes the secrets directory at the specified path on the server along with any previous secret files, and creates it again so that only the user can access it.
+func GetRecreateSecretsDirCommand(secretsDirPath string) string {
+	return fmt.Sprintf("rm -rf %s && mkdir -m 0700 %s", shellQuote(secretsDirPath), shellQuote(secretsDirPath))
+}
+
+func isSecretFile(fileName string) bool {
+	return path.Dir(fileName) == RemoteSecretsDirName
+}
+
+type permissionedReader struct {
+	io.Reader
+	permissions string
+}
+
+func (r *permissionedReader) Permissions() string {
+	return r.permissions
+}
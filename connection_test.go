@@ -22,3 +22,34 @@ func TestGetSSHClientConfig(t *testing.T) {
 		t.Errorf("Expected one auth method in SSH client config, got %d", authMethodCount)
 	}
 }
+
+func TestGetRecreateSecretsDirCommand(t *testing.T) {
+	cmd := sad.GetRecreateSecretsDirCommand("/srv/user-repo-beta/secrets")
+
+	expected := "rm -rf '/srv/user-repo-beta/secrets' && mkdir -m 0700 '/srv/user-repo-beta/secrets'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestGetMakeDirsCommand(t *testing.T) {
+	dirPaths := map[string]bool{
+		"/srv/user-repo-beta/tls":   true,
+		"/srv/user-repo-beta/nginx": true,
+	}
+
+	cmd := sad.GetMakeDirsCommand(dirPaths)
+
+	expected := "mkdir -p '/srv/user-repo-beta/nginx' '/srv/user-repo-beta/tls'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestGetShellCommand(t *testing.T) {
+	cmd := sad.GetShellCommand("/srv/user-foo-beta", "user-foo-beta", "bash", false)
+
+	testutils.CompareStrings("command", "docker exec -it 'user-foo-beta' 'bash'", cmd, t)
+
+	cmd = sad.GetShellCommand("/srv/user-foo-beta", "user-foo-beta", "bash", true)
+
+	testutils.CompareStrings("command", "cd '/srv/user-foo-beta' && exec \"${SHELL:-sh}\" -l", cmd, t)
+}
@@ -0,0 +1,75 @@
+package sad
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GetImageRepoDigestsCommand gets the command which prints the repository digests of the deployment image as a JSON array.
+// The command is meant to be run on the remote server after the image has been pulled.
+func GetImageRepoDigestsCommand(opts *Options) string {
+	return fmt.Sprintf("docker image inspect --format '{{json .RepoDigests}}' %s", opts.GetImageSpecifier())
+}
+
+// GetRegistryLoginCommand gets the command which logs in to the registry specified by the options on the remote server.
+// The password is read from standard input so that it never appears on the command line.
+// If no registry is specified, the command logs in to Docker Hub.
+func GetRegistryLoginCommand(opts *Options) string {
+	cmd := fmt.Sprintf("docker login --username %s --password-stdin", shellQuote(opts.RegistryUsername))
+
+	if opts.Registry != "" {
+		cmd += " " + shellQuote(opts.Registry)
+	}
+
+	return cmd
+}
+
+// GetRegistryLogoutCommand gets the command which logs out of the registry specified by the options on the remote server.
+func GetRegistryLogoutCommand(opts *Options) string {
+	cmd := "docker logout"
+
+	if opts.Registry != "" {
+		cmd += " " + shellQuote(opts.Registry)
+	}
+
+	return cmd
+}
+
+// ParseRepoDigests parses the output of the command generated by GetImageRepoDigestsCommand into a slice of repository digests.
+func ParseRepoDigests(output string) ([]string, error) {
+	var repoDigests []string
+
+	trimmed := strings.TrimSpace(output)
+
+	err := json.Unmarshal([]byte(trimmed), &repoDigests)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing repository digests from output \"%s\": %s", trimmed, err)
+	}
+
+	return repoDigests, nil
+}
+
+// VerifyRepoDigests verifies that the specified digest is contained in the repository digests of an image.
+// Repository digests are of the form <repository>@<digest>.
+// Returns an error if none of the repository digests reference the specified digest.
+func VerifyRepoDigests(repoDigests []string, digest string) error {
+	for _, repoDigest := range repoDigests {
+		separatorIndex := strings.LastIndex(repoDigest, "@")
+
+		if separatorIndex == -1 {
+			continue
+		}
+
+		if repoDigest[separatorIndex+1:] == digest {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("digest %s not found in repository digests %s", digest, repoDigests)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
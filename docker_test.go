@@ -0,0 +1,132 @@
+package sad_test
+
+import (
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestGetImageRepoDigestsCommand(t *testing.T) {
+	opts := sad.Options{
+		Registry: "registry.io",
+		Image:    "user/foo",
+		Digest:   "sha256:abc123",
+	}
+
+	cmd := sad.GetImageRepoDigestsCommand(&opts)
+
+	expected := "docker image inspect --format '{{json .RepoDigests}}' registry.io/user/foo@sha256:abc123"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestGetRegistryLoginCommand(t *testing.T) {
+	opts := sad.Options{
+		Registry:         "ghcr.io",
+		RegistryUsername: "user",
+		RegistryPassword: "secret",
+	}
+
+	cmd := sad.GetRegistryLoginCommand(&opts)
+
+	expected := "docker login --username 'user' --password-stdin 'ghcr.io'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+
+	if strings.Contains(cmd, opts.RegistryPassword) {
+		t.Errorf("Expected command not to contain the registry password but got: %s", cmd)
+	}
+}
+
+func TestGetRegistryLoginCommandNoRegistry(t *testing.T) {
+	opts := sad.Options{
+		RegistryUsername: "it's",
+	}
+
+	cmd := sad.GetRegistryLoginCommand(&opts)
+
+	expected := "docker login --username 'it'\"'\"'s' --password-stdin"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestGetRegistryLogoutCommand(t *testing.T) {
+	opts := sad.Options{
+		Registry: "ghcr.io",
+	}
+
+	cmd := sad.GetRegistryLogoutCommand(&opts)
+
+	expected := "docker logout 'ghcr.io'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestParseRepoDigests(t *testing.T) {
+	output := "[\"registry.io/user/foo@sha256:abc123\",\"user/foo@sha256:def456\"]\n"
+
+	repoDigests, err := sad.ParseRepoDigests(output)
+
+	if err != nil {
+		t.Fatalf("Error parsing repository digests: %s", err)
+	}
+
+	expected := []string{
+		"registry.io/user/foo@sha256:abc123",
+		"user/foo@sha256:def456",
+	}
+
+	if len(repoDigests) != len(expected) {
+		t.Fatalf("Expected %d repository digests but got %d", len(expected), len(repoDigests))
+	}
+
+	for i := range expected {
+		testutils.CompareStrings("repository digest", expected[i], repoDigests[i], t)
+	}
+}
+
+func TestParseRepoDigestsInvalid(t *testing.T) {
+	output := "Error: No such image: user/foo@sha256:abc123"
+
+	repoDigests, err := sad.ParseRepoDigests(output)
+
+	if err == nil {
+		t.Fatalf("Expected error parsing repository digests but got nil")
+	}
+
+	if repoDigests != nil {
+		t.Errorf("Expected nil repository digests but got: %s", repoDigests)
+	}
+}
+
+func TestVerifyRepoDigests(t *testing.T) {
+	repoDigests := []string{
+		"user/bar@sha256:def456",
+		"registry.io/user/foo@sha256:abc123",
+	}
+
+	err := sad.VerifyRepoDigests(repoDigests, "sha256:abc123")
+
+	if err != nil {
+		t.Errorf("Error verifying repository digests: %s", err)
+	}
+}
+
+func TestVerifyRepoDigestsMissing(t *testing.T) {
+	repoDigests := []string{
+		"registry.io/user/foo@sha256:def456",
+	}
+
+	err := sad.VerifyRepoDigests(repoDigests, "sha256:abc123")
+
+	if err == nil {
+		t.Fatalf("Expected error verifying repository digests but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "sha256:abc123") {
+		t.Errorf("Expected error to contain digest but got: %s", err)
+	}
+}
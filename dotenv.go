@@ -0,0 +1,148 @@
+package sad
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var dotEnvNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// dotEnvUnquotedValueRegexp matches values which can be written to a dotenv file without quotes.
+var dotEnvUnquotedValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_./:@+,=%-]*$`)
+
+// dotEnvValueEscaper escapes the characters which have a special meaning in double-quoted dotenv values.
+var dotEnvValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+
+// ParseDotEnv parses the contents of a dotenv file into a map of variable names to values.
+// Each line should be of the form NAME=VALUE, optionally prefixed by "export ".
+// Blank lines and lines starting with "#" are ignored.
+// Values can be wrapped in single quotes, which are taken literally, or double quotes, which support the escape sequences \n, \r, \t, \", \$, and \\.
+// Unquoted values are trimmed and can be followed by a comment starting with " #".
+func ParseDotEnv(reader io.Reader) (map[string]string, error) {
+	variables := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		separatorIndex := strings.Index(line, "=")
+
+		if separatorIndex == -1 {
+			return nil, fmt.Errorf("line %d is not of the form NAME=VALUE", lineNumber)
+		}
+
+		name := strings.TrimSpace(line[:separatorIndex])
+
+		if !dotEnvNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("line %d has an invalid variable name \"%s\"", lineNumber, name)
+		}
+
+		value, err := parseDotEnvValue(strings.TrimSpace(line[separatorIndex+1:]))
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+
+		variables[name] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return variables, nil
+}
+
+// ParseDotEnvFile parses a dotenv file at the specified path, see ParseDotEnv.
+func ParseDotEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	variables, err := ParseDotEnv(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dotenv file %s: %s", path, err)
+	}
+
+	return variables, nil
+}
+
+func parseDotEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		closingIndex := strings.Index(raw[1:], "'")
+
+		if closingIndex == -1 {
+			return "", fmt.Errorf("unterminated single-quoted value")
+		}
+
+		return raw[1 : closingIndex+1], nil
+	case '"':
+		var builder strings.Builder
+
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+
+			if c == '"' {
+				return builder.String(), nil
+			}
+
+			if c == '\\' && i+1 < len(raw) {
+				i++
+
+				switch raw[i] {
+				case 'n':
+					builder.WriteByte('\n')
+				case 'r':
+					builder.WriteByte('\r')
+				case 't':
+					builder.WriteByte('\t')
+				default:
+					builder.WriteByte(raw[i])
+				}
+
+				continue
+			}
+
+			builder.WriteByte(c)
+		}
+
+		return "", fmt.Errorf("unterminated double-quoted value")
+	default:
+		if commentIndex := strings.Index(raw, " #"); commentIndex != -1 {
+			raw = raw[:commentIndex]
+		}
+
+		return strings.TrimSpace(raw), nil
+	}
+}
+
+// formatDotEnvValue formats a value for a dotenv file so that ParseDotEnv and Docker Compose read it back unchanged.
+// Simple values are written as they are, and anything else is wrapped in double quotes with the special characters escaped.
+func formatDotEnvValue(value string) string {
+	if dotEnvUnquotedValueRegexp.MatchString(value) {
+		return value
+	}
+
+	return `"` + dotEnvValueEscaper.Replace(value) + `"`
+}
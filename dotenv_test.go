@@ -0,0 +1,62 @@
+package sad_test
+
+import (
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	content := `# comment
+FOO=bar
+export BAZ = qux # trailing comment
+
+SINGLE='literal # not a comment \n'
+DOUBLE="line one\nline \"two\""
+EMPTY=
+URL=https://example.com/#anchor
+`
+
+	variables, err := sad.ParseDotEnv(strings.NewReader(content))
+
+	if err != nil {
+		t.Fatalf("Error parsing dotenv: %s", err)
+	}
+
+	expected := map[string]string{
+		"FOO":    "bar",
+		"BAZ":    "qux",
+		"SINGLE": "literal # not a comment \\n",
+		"DOUBLE": "line one\nline \"two\"",
+		"EMPTY":  "",
+		"URL":    "https://example.com/#anchor",
+	}
+
+	if len(variables) != len(expected) {
+		t.Errorf("Expected %d variables but got %d: %s", len(expected), len(variables), variables)
+	}
+
+	for name, value := range expected {
+		testutils.CompareStrings("variable "+name, value, variables[name], t)
+	}
+}
+
+func TestParseDotEnvInvalid(t *testing.T) {
+	invalid := []string{
+		"FOO",
+		"1FOO=bar",
+		"FOO=\"bar",
+		"FOO='bar",
+	}
+
+	for _, content := range invalid {
+		_, err := sad.ParseDotEnv(strings.NewReader(content))
+
+		if err == nil {
+			t.Errorf("Expected error parsing dotenv content %s but got nil", content)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -18,13 +20,36 @@ var RemoteDockerComposeFileName string = "docker-compose.yml"
 // RemoteDotEnvFileName is the name of the remote .env file to send to the server.
 var RemoteDotEnvFileName string = ".env"
 
-// ConfigFileName is the name of the configuration file to pull options from.
+// RemoteSecretsDirName is the name of the subdirectory of the deployment on the server which contains a file for each of the secret variables, see Options.SecretVars.
+var RemoteSecretsDirName string = "secrets"
+
+// ConfigFileName is the name of the JSON configuration file to pull options from.
 var ConfigFileName string = ".sad.json"
 
+// ConfigFileNames are the names of all of the supported configuration files to pull options from.
+// All of the formats share the same schema.
+var ConfigFileNames = []string{
+	ConfigFileName,
+	".sad.yml",
+	".sad.yaml",
+	".sad.toml",
+}
+
 // FindFilePathRecursiveFileNotFoundErrorMessage is the string error message returned when FindFilePathRecursive cannot find the specified file.
 var FindFilePathRecursiveFileNotFoundErrorMessage = "file not found"
 
+// IgnoredDirectoryNames are the names of directories which are skipped when finding files recursively.
+var IgnoredDirectoryNames = []string{
+	".git",
+	"node_modules",
+	"vendor",
+}
+
+// RepositoryRootMarker is the name of the file or directory which marks the root of a repository when searching upward for the config file.
+var RepositoryRootMarker = ".git"
+
 // FindFilePathRecursive finds a file path recursively that matches the specified file name starting from the specified path.
+// Directories named in IgnoredDirectoryNames are skipped, unless the search starts from them.
 // Returns the path of the file if it is found, otherwise returns an error.
 // If the error was only that the file was not found, returns an error containing FindFilePathRecursiveFileNotFoundErrorMessage.
 func FindFilePathRecursive(fromPath string, fileName string) (string, error) {
@@ -33,7 +58,15 @@ func FindFilePathRecursive(fromPath string, fileName string) (string, error) {
 	foundErrorMessage := "file found"
 
 	err := filepath.Walk(fromPath, func(path string, info os.FileInfo, err error) error {
-		if err == nil && fileName == info.Name() {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() && path != fromPath && isIgnoredDirectory(info.Name()) {
+			return filepath.SkipDir
+		}
+
+		if fileName == info.Name() {
 			foundPath = path
 			return errors.New(foundErrorMessage)
 		}
@@ -51,26 +84,141 @@ func FindFilePathRecursive(fromPath string, fileName string) (string, error) {
 	return foundPath, nil
 }
 
+// FindConfigFile finds the configuration file by searching upward from the specified path to the root of the repository which contains it.
+// The root of the repository is the first directory containing RepositoryRootMarker. If the path is not inside of a repository, only the path itself is searched.
+// Any of the names in ConfigFileNames are accepted, and the closest directory containing a configuration file wins, but only one configuration file may exist in that directory.
+// Returns the path of the configuration file if it is found, otherwise returns an error.
+// If the error was only that no configuration file was found, returns an error containing FindFilePathRecursiveFileNotFoundErrorMessage.
+func FindConfigFile(fromPath string) (string, error) {
+	dirs, err := getDirsUpToRepositoryRoot(fromPath)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range dirs {
+		var foundPaths []string
+
+		for _, fileName := range ConfigFileNames {
+			filePath := filepath.Join(dir, fileName)
+
+			info, err := os.Stat(filePath)
+
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+
+				return "", err
+			}
+
+			if !info.IsDir() {
+				foundPaths = append(foundPaths, filePath)
+			}
+		}
+
+		if len(foundPaths) > 1 {
+			return "", fmt.Errorf("found multiple config files, only one of them should exist: %s", strings.Join(foundPaths, ", "))
+		}
+
+		if len(foundPaths) == 1 {
+			return foundPaths[0], nil
+		}
+	}
+
+	return "", errors.New(FindFilePathRecursiveFileNotFoundErrorMessage)
+}
+
 // GetEntitiesForDeployment gets (and opens if necessary) the entities needed for deployment.
-// Files are locaed by finding them recursively under the provided path.
-// Files: Docker Compose file (see DockerComposeFileName).
-// Other: generated .env file.
+// Files: the Docker Compose files found for the deployment (see FindComposeFiles), which are rendered as templates if the Template field is set (see RenderTemplate).
+// Environment: the deployment environment loaded by GetDeploymentEnv, which is injected into the .env file without changing the provided map.
+// Secret variables: each of the variables named by the SecretVars field is moved out of the .env file into its own file under RemoteSecretsDirName.
+// Included files: the files resolved from the Files field relative to the provided path (see ResolveFileIncludes), which are opened with their permissions, and rendered if their include is a template.
+// Other: generated .env file, which also records the image digest and tag (if any) of the deployment.
 // Files are only returned so they can be closed by the caller.
-func GetEntitiesForDeployment(fromPath string, opts *Options) (map[string]io.Reader, []*os.File, error) {
-	files, err := getFilesForDeployment(fromPath)
+func GetEntitiesForDeployment(fromPath string, composeFiles []ComposeFile, deploymentEnv map[string]string, opts *Options) (map[string]io.Reader, []*os.File, error) {
+	if len(composeFiles) == 0 {
+		return nil, nil, errors.New("error getting files for deployment: no Docker Compose files")
+	}
+
+	templateData, err := GetTemplateData(opts)
 
 	if err != nil {
-		return nil, files, fmt.Errorf("error getting files for deployment: %s", err)
+		return nil, nil, err
+	}
+
+	var files []*os.File
+	readerMap := make(map[string]io.Reader)
+
+	for _, composeFile := range composeFiles {
+		file, err := os.Open(composeFile.LocalPath)
+
+		if err != nil {
+			return nil, files, fmt.Errorf("error opening file for deployment from path \"%s\"", composeFile.LocalPath)
+		}
+
+		files = append(files, file)
+
+		var reader io.Reader = file
+
+		if opts.Template {
+			reader, err = RenderTemplate(filepath.Base(composeFile.LocalPath), file, templateData)
+
+			if err != nil {
+				return nil, files, fmt.Errorf("error rendering Docker Compose file: %s", err)
+			}
+		}
+
+		readerMap[composeFile.RemoteName] = reader
 	}
 
-	readerMap := FilesToFileNameReaderMap(files)
-	readerMap[RemoteDockerComposeFileName] = readerMap[LocalDockerComposeFileName]
-	delete(readerMap, LocalDockerComposeFileName)
+	env := make(map[string]string, len(deploymentEnv))
+
+	for name, value := range deploymentEnv {
+		env[name] = value
+	}
+
+	for _, name := range opts.SecretVars {
+		value, ok := env[name]
+
+		if !ok {
+			return nil, files, fmt.Errorf("secret variable %s is not set by any deployment environment variable", name)
+		}
+
+		delete(env, name)
+		readerMap[path.Join(RemoteSecretsDirName, name)] = NewPermissionedReader(strings.NewReader(value), "0400")
+	}
 
-	env, err := opts.GetDeploymentEnvValues()
+	includedFiles, err := ResolveFileIncludes(fromPath, opts.Files)
 
 	if err != nil {
-		return nil, files, fmt.Errorf("error getting referenced environment variables: %s", err)
+		return nil, files, fmt.Errorf("error getting included files: %s", err)
+	}
+
+	for _, includedFile := range includedFiles {
+		file, err := os.Open(includedFile.LocalPath)
+
+		if err != nil {
+			return nil, files, fmt.Errorf("error opening included file from path \"%s\": %s", includedFile.LocalPath, err)
+		}
+
+		files = append(files, file)
+
+		if _, ok := readerMap[includedFile.RemotePath]; ok {
+			return nil, files, fmt.Errorf("error getting included files: remote path \"%s\" is already used by a Docker Compose file", includedFile.RemotePath)
+		}
+
+		var reader io.Reader = file
+
+		if includedFile.Template {
+			reader, err = RenderTemplate(filepath.ToSlash(includedFile.LocalPath), file, templateData)
+
+			if err != nil {
+				return nil, files, fmt.Errorf("error rendering included file: %s", err)
+			}
+		}
+
+		readerMap[includedFile.RemotePath] = NewPermissionedReader(reader, includedFile.Permissions)
 	}
 
 	imageSpecifier := opts.GetImageSpecifier()
@@ -82,19 +230,46 @@ func GetEntitiesForDeployment(fromPath string, opts *Options) (map[string]io.Rea
 	}
 
 	env["IMAGE"] = imageSpecifier
+	env["IMAGE_DIGEST"] = opts.Digest
 	env["CONTAINER_NAME"] = deploymentName
 
+	if opts.Tag != "" {
+		env["IMAGE_TAG"] = opts.Tag
+	}
+
 	readerMap[RemoteDotEnvFileName] = GenerateDotEnvFile(env)
 
 	return readerMap, files, nil
 }
 
-// GenerateDotEnvFile generates a file as a reader which contains a properly-formatted .env file.
+// GetDeploymentEnv gets the values of the environment variables to be injected into the deployment, including the secrets from the encrypted secrets file next to the first of the Docker Compose files found for the deployment (see FindComposeFiles).
+// The secrets are decrypted in memory (see LocalSecretsFileName), so this should only be called once for a deployment.
+// The variables generated by Sad such as IMAGE are not included.
+// Also returns the values of the secret variables keyed by name, which should be redacted from output: the variables decrypted from the encrypted secrets file, and the variables named by the SecretVars field.
+func GetDeploymentEnv(composeFiles []ComposeFile, opts *Options) (map[string]string, map[string]string, error) {
+	if len(composeFiles) == 0 {
+		return nil, nil, errors.New("no Docker Compose files")
+	}
+
+	return getDeploymentEnv(composeFiles[0].LocalPath, opts)
+}
+
+// GenerateDotEnvFile generates a file as a reader which contains a properly-formatted .env file, with the variables sorted by name.
+// Values which contain anything other than letters, digits, and simple punctuation are wrapped in double quotes, escaping backslashes, double quotes, dollar signs, and line breaks.
+// This keeps multi-line values such as private keys on a single line, so that they can't break the file or add other variables to it.
 func GenerateDotEnvFile(variables map[string]string) io.Reader {
+	names := make([]string, 0, len(variables))
+
+	for name := range variables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
 	var s string
 
-	for name, value := range variables {
-		s += fmt.Sprintf("%s=%s\n", name, value)
+	for _, name := range names {
+		s += fmt.Sprintf("%s=%s\n", name, formatDotEnvValue(variables[name]))
 	}
 
 	return strings.NewReader(s)
@@ -112,35 +287,71 @@ func FilesToFileNameReaderMap(files []*os.File) map[string]io.Reader {
 	return m
 }
 
-func getFilesForDeployment(fromPath string) ([]*os.File, error) {
-	var filePaths []string
-	var files []*os.File
+// getDirsUpToRepositoryRoot gets the specified path and each of its parents up to and including the root of the repository.
+// If no repository root is found, only the specified path is returned.
+func getDirsUpToRepositoryRoot(fromPath string) ([]string, error) {
+	absPath, err := filepath.Abs(fromPath)
 
-	fileNames := []string{
-		LocalDockerComposeFileName,
+	if err != nil {
+		return nil, fmt.Errorf("error getting absolute path of \"%s\": %s", fromPath, err)
 	}
 
-	for _, fileName := range fileNames {
-		filePath, err := FindFilePathRecursive(fromPath, fileName)
+	var dirs []string
 
-		if err != nil {
-			err := fmt.Errorf("error finding file \"%s\" under path \"%s\": %s", fileName, fromPath, err)
-			return nil, err
+	dir := absPath
+
+	for {
+		dirs = append(dirs, dir)
+
+		if _, err := os.Stat(filepath.Join(dir, RepositoryRootMarker)); err == nil {
+			return dirs, nil
 		}
 
-		filePaths = append(filePaths, filePath)
-	}
+		parent := filepath.Dir(dir)
 
-	for _, filePath := range filePaths {
-		file, err := os.Open(filePath)
+		if parent == dir {
+			return []string{absPath}, nil
+		}
 
-		if err != nil {
-			err := fmt.Errorf("error opening file for deployment from path \"%s\"", filePath)
-			return nil, err
+		dir = parent
+	}
+}
+
+func isIgnoredDirectory(name string) bool {
+	for _, ignoredName := range IgnoredDirectoryNames {
+		if name == ignoredName {
+			return true
 		}
+	}
 
-		files = append(files, file)
+	return false
+}
+
+func getDeploymentEnv(composeFilePath string, opts *Options) (map[string]string, map[string]string, error) {
+	secretsPath := filepath.Join(filepath.Dir(composeFilePath), LocalSecretsFileName)
+	secrets, err := ReadSecretsFile(secretsPath, opts)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting secrets: %s", err)
+	}
+
+	env, err := opts.GetDeploymentEnvValuesWithSecrets(secrets)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting referenced environment variables: %s", err)
+	}
+
+	secretEnv := make(map[string]string)
+
+	for name := range secrets {
+		secretEnv[name] = env[name]
+	}
+
+	for _, name := range opts.SecretVars {
+		if value, ok := env[name]; ok {
+			secretEnv[name] = value
+		}
 	}
 
-	return files, nil
+	return env, secretEnv, nil
 }
@@ -95,6 +95,138 @@ func TestFindFilePathRecursiveNotFound(t *testing.T) {
 	testutils.CompareStrings("file path", expected, actual, t)
 }
 
+func TestFindConfigFile(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	_, err = sad.FindConfigFile(tempDirPath)
+
+	if err == nil || err.Error() != sad.FindFilePathRecursiveFileNotFoundErrorMessage {
+		t.Errorf("Expected not found error but got: %s", err)
+	}
+
+	yamlPath := filepath.Join(tempDirPath, ".sad.yml")
+
+	if err := ioutil.WriteFile(yamlPath, []byte("rootDir: /srv\n"), 0644); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", yamlPath, err)
+	}
+
+	path, err := sad.FindConfigFile(tempDirPath)
+
+	if err != nil {
+		t.Fatalf("Error finding config file: %s", err)
+	}
+
+	testutils.CompareStrings("config file path", yamlPath, path, t)
+
+	jsonPath := filepath.Join(tempDirPath, sad.ConfigFileName)
+
+	if err := ioutil.WriteFile(jsonPath, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", jsonPath, err)
+	}
+
+	_, err = sad.FindConfigFile(tempDirPath)
+
+	if err == nil {
+		t.Fatalf("Expected error finding multiple config files but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "multiple config files") {
+		t.Errorf("Expected multiple config files error but got: %s", err)
+	}
+}
+
+func TestFindConfigFileUpward(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	nestedDirPath := filepath.Join(tempDirPath, "apps", "foo")
+
+	if err := os.MkdirAll(nestedDirPath, 0755); err != nil {
+		t.Fatalf("Error creating nested dir: %s", err)
+	}
+
+	configPath := filepath.Join(tempDirPath, ".sad.toml")
+
+	if err := ioutil.WriteFile(configPath, []byte(""), 0644); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", configPath, err)
+	}
+
+	_, err = sad.FindConfigFile(nestedDirPath)
+
+	if err == nil || err.Error() != sad.FindFilePathRecursiveFileNotFoundErrorMessage {
+		t.Errorf("Expected not found error outside of a repository but got: %s", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(tempDirPath, sad.RepositoryRootMarker), 0755); err != nil {
+		t.Fatalf("Error creating repository root marker: %s", err)
+	}
+
+	path, err := sad.FindConfigFile(nestedDirPath)
+
+	if err != nil {
+		t.Fatalf("Error finding config file: %s", err)
+	}
+
+	testutils.CompareStrings("config file path", configPath, path, t)
+
+	nestedConfigPath := filepath.Join(tempDirPath, "apps", sad.ConfigFileName)
+
+	if err := ioutil.WriteFile(nestedConfigPath, []byte("{}"), 0644); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", nestedConfigPath, err)
+	}
+
+	path, err = sad.FindConfigFile(nestedDirPath)
+
+	if err != nil {
+		t.Fatalf("Error finding config file: %s", err)
+	}
+
+	testutils.CompareStrings("config file path", nestedConfigPath, path, t)
+}
+
+func TestFindFilePathRecursiveIgnoredDirectories(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	fileName := "file.test"
+
+	for _, dirName := range sad.IgnoredDirectoryNames {
+		dirPath := filepath.Join(tempDirPath, dirName)
+
+		if err := os.Mkdir(dirPath, 0755); err != nil {
+			t.Fatalf("Error creating ignored dir: %s", err)
+		}
+
+		filePath := filepath.Join(dirPath, fileName)
+
+		if err := ioutil.WriteFile(filePath, []byte("test"), 0644); err != nil {
+			t.Fatalf("Error writing to temp file \"%s\", %s", filePath, err)
+		}
+	}
+
+	_, err = sad.FindFilePathRecursive(tempDirPath, fileName)
+
+	if err == nil || err.Error() != sad.FindFilePathRecursiveFileNotFoundErrorMessage {
+		t.Errorf("Expected not found error but got: %s", err)
+	}
+}
+
 func TestGetEntitesForDeployment(t *testing.T) {
 	dirName := "dir.test"
 
@@ -136,6 +268,7 @@ func TestGetEntitesForDeployment(t *testing.T) {
 	opts := &sad.Options{
 		Image:   "user/repo",
 		Digest:  "abc123",
+		Tag:     "v1.2.3",
 		Channel: "beta",
 		EnvVars: envVarNames,
 	}
@@ -146,7 +279,9 @@ func TestGetEntitesForDeployment(t *testing.T) {
 	testutils.SetEnvVarsConstant(opts.EnvVars, prefix, variableContent)
 	defer testutils.UnsetEnvVars(opts.EnvVars, prefix)
 
-	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, opts)
+	composeFiles := findComposeFiles(tempDirPath, opts, t)
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, composeFiles, getDeploymentEnv(composeFiles, opts, t), opts)
 
 	if err != nil {
 		t.Fatalf("Error getting files for deployment: %s", err)
@@ -180,6 +315,8 @@ func TestGetEntitesForDeployment(t *testing.T) {
 		"foo=test",
 		"baz=test",
 		"IMAGE=user/repo@abc123",
+		"IMAGE_DIGEST=abc123",
+		"IMAGE_TAG=v1.2.3",
 		"CONTAINER_NAME=user-repo-beta",
 	}
 
@@ -221,6 +358,43 @@ func TestGenerateDotEnvFile(t *testing.T) {
 	testutils.CompareReaderLines(".env file", expected, reader, t)
 }
 
+func TestGenerateDotEnvFileQuotesValues(t *testing.T) {
+	variables := map[string]string{
+		"KEY":     "-----BEGIN KEY-----\nabc\nINJECTED=value\n-----END KEY-----",
+		"QUOTED":  `say "hi" \ pay $5`,
+		"SPACED":  " padded # not a comment ",
+		"SIMPLE":  "user/repo@sha256:abc",
+		"EMPTY":   "",
+		"WINDOWS": "line\r\nbreak",
+	}
+
+	content := testutils.ReadFromReader(".env file", sad.GenerateDotEnvFile(variables), t)
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	if len(lines) != len(variables) {
+		t.Fatalf("Expected one line per variable but got:\n%s", content)
+	}
+
+	if !strings.Contains(content, "SIMPLE=user/repo@sha256:abc\n") {
+		t.Errorf("Expected simple value not to be quoted but got:\n%s", content)
+	}
+
+	parsed, err := sad.ParseDotEnv(strings.NewReader(content))
+
+	if err != nil {
+		t.Fatalf("Error parsing generated .env file: %s", err)
+	}
+
+	if len(parsed) != len(variables) {
+		t.Errorf("Expected %d variables but got %d: %v", len(variables), len(parsed), parsed)
+	}
+
+	for name, expected := range variables {
+		testutils.CompareStrings(name, expected, parsed[name], t)
+	}
+}
+
 func TestFilesToFileNameReaderMap(t *testing.T) {
 	var tempFiles []*os.File
 
@@ -271,3 +445,201 @@ func TestFilesToFileNameReaderMap(t *testing.T) {
 		}
 	}
 }
+
+func TestGetDeploymentEnv(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	composeFilePath := filepath.Join(tempDirPath, sad.LocalDockerComposeFileName)
+
+	if err := ioutil.WriteFile(composeFilePath, []byte("test"), 0755); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", composeFilePath, err)
+	}
+
+	identity := generateAgeIdentity(t)
+	secretsFilePath := filepath.Join(tempDirPath, sad.LocalSecretsFileName)
+
+	if err := ioutil.WriteFile(secretsFilePath, encryptSecrets(testSecretsContent, identity, false, t), 0600); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", secretsFilePath, err)
+	}
+
+	opts := &sad.Options{
+		AgeKey:     identity.String(),
+		EnvVars:    []string{"SECRET", "FOO"},
+		EnvValues:  map[string]string{"FOO": "bar", "PASSWORD": "letmein"},
+		SecretVars: []string{"PASSWORD"},
+	}
+
+	env, secretEnv, err := sad.GetDeploymentEnv(findComposeFiles(tempDirPath, opts, t), opts)
+
+	if err != nil {
+		t.Fatalf("Error getting deployment environment: %s", err)
+	}
+
+	testutils.CompareStrings("variable SECRET", "hunter2", env["SECRET"], t)
+	testutils.CompareStrings("variable TOKEN", "abc 123", env["TOKEN"], t)
+	testutils.CompareStrings("variable FOO", "bar", env["FOO"], t)
+
+	if _, ok := env["IMAGE"]; ok {
+		t.Errorf("Expected generated variable IMAGE not to be included but got: %s", env["IMAGE"])
+	}
+
+	expectedSecretEnv := map[string]string{"SECRET": "hunter2", "TOKEN": "abc 123", "PASSWORD": "letmein"}
+
+	if len(secretEnv) != len(expectedSecretEnv) {
+		t.Errorf("Expected secret variables %v but got %v", expectedSecretEnv, secretEnv)
+	}
+
+	for name, value := range expectedSecretEnv {
+		testutils.CompareStrings("secret variable "+name, value, secretEnv[name], t)
+	}
+}
+
+func TestGetEntitiesForDeploymentSecretVars(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	composeFilePath := filepath.Join(tempDirPath, sad.LocalDockerComposeFileName)
+
+	if err := ioutil.WriteFile(composeFilePath, []byte("test"), 0755); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", composeFilePath, err)
+	}
+
+	opts := &sad.Options{
+		Image:      "user/repo",
+		Digest:     "abc123",
+		Channel:    "beta",
+		EnvValues:  map[string]string{"FOO": "bar", "PASSWORD": "hunter2"},
+		SecretVars: []string{"PASSWORD"},
+	}
+
+	composeFiles := findComposeFiles(tempDirPath, opts, t)
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, composeFiles, getDeploymentEnv(composeFiles, opts, t), opts)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
+	if err != nil {
+		t.Fatalf("Error getting files for deployment: %s", err)
+	}
+
+	secretReader, ok := readerMap["secrets/PASSWORD"]
+
+	if !ok {
+		t.Fatalf("Expected a secret file for PASSWORD but got readers for: %v", readerMap)
+	}
+
+	testutils.CompareStrings("secret file", "hunter2", testutils.ReadFromReader("secret file", secretReader, t), t)
+
+	dotEnv := testutils.ReadFromReader(".env file", readerMap[sad.RemoteDotEnvFileName], t)
+
+	if strings.Contains(dotEnv, "hunter2") {
+		t.Errorf("Expected .env file not to contain the secret value but got:\n%s", dotEnv)
+	}
+
+	if !strings.Contains(dotEnv, "FOO=bar") {
+		t.Errorf("Expected .env file to contain FOO=bar but got:\n%s", dotEnv)
+	}
+}
+
+func TestGetEntitiesForDeploymentDeploymentEnv(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	composeFilePath := filepath.Join(tempDirPath, sad.LocalDockerComposeFileName)
+
+	if err := ioutil.WriteFile(composeFilePath, []byte("test"), 0755); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", composeFilePath, err)
+	}
+
+	opts := &sad.Options{
+		Image:      "user/repo",
+		Digest:     "abc123",
+		Channel:    "beta",
+		SecretVars: []string{"PASSWORD"},
+	}
+
+	env := map[string]string{"FOO": "loaded", "PASSWORD": "hunter2"}
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, findComposeFiles(tempDirPath, opts, t), env, opts)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
+	if err != nil {
+		t.Fatalf("Error getting files for deployment: %s", err)
+	}
+
+	dotEnv := testutils.ReadFromReader(".env file", readerMap[sad.RemoteDotEnvFileName], t)
+
+	if !strings.Contains(dotEnv, "FOO=loaded") {
+		t.Errorf("Expected .env file to contain the provided value FOO=loaded but got:\n%s", dotEnv)
+	}
+
+	if len(env) != 2 || env["PASSWORD"] != "hunter2" {
+		t.Errorf("Expected the provided deployment environment not to be changed but got: %v", env)
+	}
+}
+
+func TestGetEntitiesForDeploymentSecretVarsMissing(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	composeFilePath := filepath.Join(tempDirPath, sad.LocalDockerComposeFileName)
+
+	if err := ioutil.WriteFile(composeFilePath, []byte("test"), 0755); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", composeFilePath, err)
+	}
+
+	opts := &sad.Options{
+		Image:      "user/repo",
+		Digest:     "abc123",
+		Channel:    "beta",
+		SecretVars: []string{"PASSWORD"},
+	}
+
+	composeFiles := findComposeFiles(tempDirPath, opts, t)
+
+	_, files, err := sad.GetEntitiesForDeployment(tempDirPath, composeFiles, getDeploymentEnv(composeFiles, opts, t), opts)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "PASSWORD") {
+		t.Errorf("Expected error about the missing secret variable but got: %v", err)
+	}
+}
+
+func getDeploymentEnv(composeFiles []sad.ComposeFile, opts *sad.Options, t *testing.T) map[string]string {
+	env, _, err := sad.GetDeploymentEnv(composeFiles, opts)
+
+	if err != nil {
+		t.Fatalf("Error getting deployment environment: %s", err)
+	}
+
+	return env
+}
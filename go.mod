@@ -3,6 +3,10 @@ module github.com/jswny/sad
 go 1.15
 
 require (
+	filippo.io/age v1.0.0
+	github.com/BurntSushi/toml v0.3.1
 	github.com/bramvdbogaerde/go-scp v0.0.0-20200820121624-ded9ee94aef5
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
+	golang.org/x/term v0.0.0-20210615171337-6886f2dfbf5b
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,84 @@
+package sad
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ReleaseFilter selects releases from the audit log.
+// Empty fields match every release, and a limit of 0 keeps all of the matching releases.
+type ReleaseFilter struct {
+	Status   string
+	Deployer string
+	Since    time.Time
+	Limit    int
+}
+
+// FilterReleases gets the releases which match the filter, newest first, keeping at most the limit of the filter.
+// The releases should be in the order of the audit log, oldest first.
+func FilterReleases(releases []Release, filter ReleaseFilter) []Release {
+	var filtered []Release
+
+	for i := len(releases) - 1; i >= 0; i-- {
+		release := releases[i]
+
+		if filter.Status != "" && release.Status != filter.Status {
+			continue
+		}
+
+		if filter.Deployer != "" && !strings.EqualFold(release.Deployer, filter.Deployer) {
+			continue
+		}
+
+		if !filter.Since.IsZero() && release.StartedAt.Before(filter.Since) {
+			continue
+		}
+
+		filtered = append(filtered, release)
+
+		if filter.Limit > 0 && len(filtered) == filter.Limit {
+			break
+		}
+	}
+
+	return filtered
+}
+
+// ParseSince parses the start of a time range, either as a duration before the specified time such as "24h", or as a date such as "2021-09-01" or an RFC 3339 time such as "2021-09-01T12:00:00Z".
+// Dates are in UTC.
+func ParseSince(since string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(since); err == nil {
+		return now.Add(-duration), nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339, since); err == nil {
+		return parsed, nil
+	}
+
+	if parsed, err := time.Parse("2006-01-02", since); err == nil {
+		return parsed, nil
+	}
+
+	return time.Time{}, fmt.Errorf("\"%s\" is not a duration such as 24h, a date such as 2021-09-01, or a time such as 2021-09-01T12:00:00Z", since)
+}
+
+// PruneAuditLog removes all but the specified number of most recent releases from the audit log in the deployment directory on the server.
+// Like AppendAuditLog, the audit log is only changed while the specified lock holds the deployment directory.
+func PruneAuditLog(sshClient *ssh.Client, remotePath string, lock *Lock, keep int) error {
+	_, err := SSHRunCommand(sshClient, GetPruneAuditLogCommand(remotePath, lock.ID, keep))
+
+	return err
+}
+
+// GetPruneAuditLogCommand gets the command which keeps only the specified number of last lines of the audit log in the deployment directory, if it exists.
+// The pruned audit log is written to a temporary file first and then moved into place, so that it is never partially written.
+// The command fails without changing the audit log if the lock file does not contain the specified lock ID.
+func GetPruneAuditLogCommand(remotePath string, lockID string, keep int) string {
+	auditLogPath := shellQuote(remotePath + "/" + RemoteAuditLogFileName)
+	tempPath := shellQuote(remotePath + "/" + RemoteAuditLogFileName + ".tmp")
+
+	return getWhileLockedCommand(remotePath, lockID, fmt.Sprintf("if [ -f %s ]; then tail -n %d %s > %s && mv %s %s; fi", auditLogPath, keep, auditLogPath, tempPath, tempPath, auditLogPath))
+}
@@ -0,0 +1,141 @@
+package sad_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func getTestReleases() []sad.Release {
+	start := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	return []sad.Release{
+		{Digest: "sha256:aaa", Deployer: "octocat", StartedAt: start, FinishedAt: start.Add(time.Minute), Status: sad.ReleaseStatusSucceeded},
+		{Digest: "sha256:bbb", Deployer: "hubot", StartedAt: start.Add(24 * time.Hour), FinishedAt: start.Add(24*time.Hour + time.Minute), Status: sad.ReleaseStatusFailed},
+		{Digest: "sha256:ccc", Deployer: "octocat", StartedAt: start.Add(48 * time.Hour), FinishedAt: start.Add(48*time.Hour + 2*time.Minute), Status: sad.ReleaseStatusSucceeded},
+		{Digest: "sha256:ddd", Deployer: "octocat", StartedAt: start.Add(72 * time.Hour), FinishedAt: start.Add(72*time.Hour + time.Minute), Status: sad.ReleaseStatusSucceeded},
+	}
+}
+
+func compareReleaseDigests(expected []string, actual []sad.Release, t *testing.T) {
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected %d releases but got %d: %v", len(expected), len(actual), actual)
+	}
+
+	for i := range expected {
+		testutils.CompareStrings("release digest", expected[i], actual[i].Digest, t)
+	}
+}
+
+func TestFilterReleases(t *testing.T) {
+	releases := getTestReleases()
+
+	compareReleaseDigests([]string{"sha256:ddd", "sha256:ccc", "sha256:bbb", "sha256:aaa"}, sad.FilterReleases(releases, sad.ReleaseFilter{}), t)
+
+	compareReleaseDigests([]string{"sha256:bbb"}, sad.FilterReleases(releases, sad.ReleaseFilter{Status: sad.ReleaseStatusFailed}), t)
+
+	compareReleaseDigests([]string{"sha256:ddd", "sha256:ccc"}, sad.FilterReleases(releases, sad.ReleaseFilter{Deployer: "OctoCat", Limit: 2}), t)
+
+	since := releases[1].StartedAt
+	compareReleaseDigests([]string{"sha256:ddd", "sha256:ccc", "sha256:bbb"}, sad.FilterReleases(releases, sad.ReleaseFilter{Since: since}), t)
+}
+
+func TestReleaseDuration(t *testing.T) {
+	releases := getTestReleases()
+
+	if releases[2].Duration() != 2*time.Minute {
+		t.Errorf("Expected duration 2m0s but got %s", releases[2].Duration())
+	}
+
+	unfinished := sad.Release{StartedAt: time.Now()}
+
+	if unfinished.Duration() != 0 {
+		t.Errorf("Expected duration 0s for an unfinished release but got %s", unfinished.Duration())
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2021, 9, 2, 12, 0, 0, 0, time.UTC)
+
+	expected := map[string]time.Time{
+		"24h":                  time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC),
+		"2021-09-01":           time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC),
+		"2021-09-01T06:30:00Z": time.Date(2021, 9, 1, 6, 30, 0, 0, time.UTC),
+	}
+
+	for since, expectedTime := range expected {
+		actual, err := sad.ParseSince(since, now)
+
+		if err != nil {
+			t.Errorf("Error parsing since \"%s\": %s", since, err)
+			continue
+		}
+
+		if !actual.Equal(expectedTime) {
+			t.Errorf("Expected since \"%s\" to be %s but got %s", since, expectedTime, actual)
+		}
+	}
+
+	if _, err := sad.ParseSince("yesterday", now); err == nil {
+		t.Errorf("Expected error parsing since \"yesterday\" but got nil")
+	}
+}
+
+func TestPruneAuditLogCommandShell(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "sad-history-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	lock := writeTestLockFile(tempDirPath, t)
+
+	if err := exec.Command("sh", "-c", sad.GetPruneAuditLogCommand(tempDirPath, lock.ID, 2)).Run(); err != nil {
+		t.Fatalf("Error pruning missing audit log: %s", err)
+	}
+
+	auditLogPath := filepath.Join(tempDirPath, sad.RemoteAuditLogFileName)
+
+	if _, err := os.Stat(auditLogPath); !os.IsNotExist(err) {
+		t.Errorf("Expected missing audit log not to be created but got: %v", err)
+	}
+
+	if err := ioutil.WriteFile(auditLogPath, []byte("first\nsecond\nthird\n"), 0644); err != nil {
+		t.Fatalf("Error writing audit log: %s", err)
+	}
+
+	other, _ := sad.NewLock()
+
+	if err := exec.Command("sh", "-c", sad.GetPruneAuditLogCommand(tempDirPath, other.ID, 2)).Run(); err == nil {
+		t.Errorf("Expected error pruning the audit log without holding the lock but got nil")
+	}
+
+	content, err := ioutil.ReadFile(auditLogPath)
+
+	if err != nil {
+		t.Fatalf("Error reading audit log: %s", err)
+	}
+
+	testutils.CompareStrings("audit log", "first\nsecond\nthird\n", string(content), t)
+
+	if err := exec.Command("sh", "-c", sad.GetPruneAuditLogCommand(tempDirPath, lock.ID, 2)).Run(); err != nil {
+		t.Fatalf("Error pruning audit log: %s", err)
+	}
+
+	content, err = ioutil.ReadFile(auditLogPath)
+
+	if err != nil {
+		t.Fatalf("Error reading audit log: %s", err)
+	}
+
+	testutils.CompareStrings("audit log", "second\nthird\n", string(content), t)
+}
@@ -0,0 +1,145 @@
+package sad
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HookPhasePreUpload hooks run before the files are sent to the server.
+// HookPhasePreStart hooks run after the image is pulled and verified, but before the app is started.
+// HookPhasePostStart hooks run after the app is started.
+// HookPhaseOnFailure hooks run if any step of the deployment fails after the deployment lock is acquired, including another hook.
+var (
+	HookPhasePreUpload = "pre-upload"
+	HookPhasePreStart  = "pre-start"
+	HookPhasePostStart = "post-start"
+	HookPhaseOnFailure = "on-failure"
+)
+
+// HookPhases are all of the supported hook phases, in the order in which they run.
+var HookPhases = []string{
+	HookPhasePreUpload,
+	HookPhasePreStart,
+	HookPhasePostStart,
+	HookPhaseOnFailure,
+}
+
+// HookRunLocal hooks run on the machine running Sad, in the directory from which Sad is run.
+// HookRunRemote hooks run on the server via SSH, in the deployment directory.
+var (
+	HookRunLocal  = "local"
+	HookRunRemote = "remote"
+)
+
+// Hook is a shell command which runs during a phase of the deployment.
+// Run specifies where the command runs, either HookRunLocal or HookRunRemote.
+// If a service is specified for a remote hook, the command runs in a new container for that service with "docker-compose run" instead, such as to run database migrations with the new image.
+type Hook struct {
+	Command string `yaml:"command,omitempty" toml:"command,omitempty"`
+	Run     string `yaml:"run,omitempty" toml:"run,omitempty"`
+	Service string `yaml:"service,omitempty" toml:"service,omitempty"`
+}
+
+// String formats the hook as <run>: <command>, including the service for hooks which run in a container.
+func (h Hook) String() string {
+	if h.Service != "" {
+		return fmt.Sprintf("%s (%s): %s", h.Run, h.Service, h.Command)
+	}
+
+	return fmt.Sprintf("%s: %s", h.Run, h.Command)
+}
+
+// Verify verifies that the hook has a command, and that it runs either locally or remotely, with a service only if it runs remotely.
+func (h Hook) Verify() error {
+	if strings.TrimSpace(h.Command) == "" {
+		return fmt.Errorf("command is <empty>")
+	}
+
+	if h.Run != HookRunLocal && h.Run != HookRunRemote {
+		return fmt.Errorf("run \"%s\" should be one of %s, %s", h.Run, HookRunLocal, HookRunRemote)
+	}
+
+	if h.Service != "" && h.Run != HookRunRemote {
+		return fmt.Errorf("service \"%s\" can only be used with remote hooks", h.Service)
+	}
+
+	return nil
+}
+
+// RunHook runs the hook locally in the specified directory, or remotely in the deployment directory on the server.
+// Remote hooks with a service run with "docker-compose run" using each of the Docker Compose files.
+// Returns the combined output of the command, or an error if it fails.
+func RunHook(sshClient *ssh.Client, fromPath string, remotePath string, composeFiles []ComposeFile, hook Hook) (string, error) {
+	if hook.Run == HookRunLocal {
+		return RunLocalHook(fromPath, hook)
+	}
+
+	return SSHRunCommand(sshClient, GetRemoteHookCommand(remotePath, composeFiles, hook))
+}
+
+// RunLocalHook runs the command of the hook with "sh -c" in the specified directory.
+// Returns the combined output of the command, or an error if it fails.
+func RunLocalHook(fromPath string, hook Hook) (string, error) {
+	cmd := exec.Command("sh", "-c", hook.Command)
+	cmd.Dir = fromPath
+
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		return string(output), fmt.Errorf("failed to execute command \"%s\": %s", hook.Command, err)
+	}
+
+	return string(output), nil
+}
+
+// GetRemoteHookCommand gets the command which runs the hook in the deployment directory on the server.
+// If the hook has a service, the command runs in a new container for the service, which is removed afterwards.
+func GetRemoteHookCommand(remotePath string, composeFiles []ComposeFile, hook Hook) string {
+	cmd := hook.Command
+
+	if hook.Service != "" {
+		args := fmt.Sprintf("run --rm %s sh -c %s", shellQuote(hook.Service), shellQuote(hook.Command))
+		cmd = GetComposeCommand(composeFiles, args)
+	}
+
+	return fmt.Sprintf("cd %s && %s", shellQuote(remotePath), cmd)
+}
+
+// verifyHooks verifies that each phase is supported and that each hook is valid, checking the phases sorted by name.
+func verifyHooks(hooks map[string][]Hook) error {
+	phases := make([]string, 0, len(hooks))
+
+	for phase := range hooks {
+		phases = append(phases, phase)
+	}
+
+	sort.Strings(phases)
+
+	for _, phase := range phases {
+		if !isHookPhase(phase) {
+			return fmt.Errorf("phase \"%s\" should be one of %s", phase, strings.Join(HookPhases, ", "))
+		}
+
+		for _, hook := range hooks[phase] {
+			if err := hook.Verify(); err != nil {
+				return fmt.Errorf("%s hook %s is invalid: %s", phase, hook, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isHookPhase(phase string) bool {
+	for _, hookPhase := range HookPhases {
+		if phase == hookPhase {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+package sad_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestHookVerify(t *testing.T) {
+	valid := []sad.Hook{
+		{Command: "make warmup", Run: sad.HookRunLocal},
+		{Command: "./migrate.sh", Run: sad.HookRunRemote},
+		{Command: "rake db:migrate", Run: sad.HookRunRemote, Service: "app"},
+	}
+
+	for _, hook := range valid {
+		if err := hook.Verify(); err != nil {
+			t.Errorf("Error verifying hook %s: %s", hook, err)
+		}
+	}
+
+	invalid := []sad.Hook{
+		{Command: " ", Run: sad.HookRunLocal},
+		{Command: "make warmup"},
+		{Command: "make warmup", Run: "server"},
+		{Command: "rake db:migrate", Run: sad.HookRunLocal, Service: "app"},
+	}
+
+	for _, hook := range invalid {
+		if err := hook.Verify(); err == nil {
+			t.Errorf("Expected error verifying hook %s but got nil", hook)
+		}
+	}
+}
+
+func TestGetRemoteHookCommand(t *testing.T) {
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: sad.LocalDockerComposeFileName, RemoteName: sad.RemoteDockerComposeFileName},
+	}
+
+	hook := sad.Hook{Command: "./warmup.sh", Run: sad.HookRunRemote}
+
+	cmd := sad.GetRemoteHookCommand("/srv/foo-beta", composeFiles, hook)
+
+	testutils.CompareStrings("command", "cd '/srv/foo-beta' && ./warmup.sh", cmd, t)
+}
+
+func TestGetRemoteHookCommandService(t *testing.T) {
+	composeFiles := []sad.ComposeFile{
+		{LocalPath: sad.LocalDockerComposeFileName, RemoteName: sad.RemoteDockerComposeFileName},
+		{LocalPath: ".sad.docker-compose.prod.yml", RemoteName: "docker-compose.prod.yml"},
+	}
+
+	hook := sad.Hook{Command: "echo 'migrating' && rake db:migrate", Run: sad.HookRunRemote, Service: "app"}
+
+	cmd := sad.GetRemoteHookCommand("/srv/foo-prod", composeFiles, hook)
+
+	expected := "cd '/srv/foo-prod' && docker-compose -f 'docker-compose.yml' -f 'docker-compose.prod.yml' run --rm 'app' sh -c 'echo '\"'\"'migrating'\"'\"' && rake db:migrate'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestRunLocalHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sad-hooks-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(dir+"/version.txt", []byte("1.2.3\n"), 0644); err != nil {
+		t.Fatalf("Error writing test file: %s", err)
+	}
+
+	hook := sad.Hook{Command: "echo version && cat version.txt", Run: sad.HookRunLocal}
+
+	output, err := sad.RunLocalHook(dir, hook)
+
+	if err != nil {
+		t.Fatalf("Error running hook: %s", err)
+	}
+
+	testutils.CompareStrings("output", "version\n1.2.3\n", output, t)
+}
+
+func TestRunLocalHookFailure(t *testing.T) {
+	hook := sad.Hook{Command: "echo migration failed >&2 && exit 3", Run: sad.HookRunLocal}
+
+	output, err := sad.RunLocalHook(".", hook)
+
+	if err == nil {
+		t.Fatalf("Expected error running failing hook but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("Expected error to contain exit status but got: %s", err)
+	}
+
+	testutils.CompareStrings("output", "migration failed\n", output, t)
+}
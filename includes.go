@@ -0,0 +1,266 @@
+package sad
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultIncludedFilePermissions are the permissions of included files on the server if the include does not specify any.
+var DefaultIncludedFilePermissions = "0644"
+
+// FileInclude describes local files to send to the server along with the deployment.
+// The source is a local path or glob relative to the directory from which Sad is run, and it may match directories, which are sent recursively.
+// The target is the path on the server relative to the deployment directory:
+// for a single file, it is the path of the file; otherwise it is the directory which the matched files are sent into.
+// If the target is empty, the files keep their local paths relative to the directory from which Sad is run.
+// If template is set, the files are rendered as templates, see RenderTemplate.
+type FileInclude struct {
+	Source      string `yaml:"source,omitempty" toml:"source,omitempty"`
+	Target      string `yaml:"target,omitempty" toml:"target,omitempty"`
+	Permissions string `yaml:"permissions,omitempty" toml:"permissions,omitempty"`
+	Template    bool   `yaml:"template,omitempty" toml:"template,omitempty"`
+}
+
+// String formats the include as <source>:<target>, or just the source if there is no target.
+func (i FileInclude) String() string {
+	if i.Target == "" {
+		return i.Source
+	}
+
+	return i.Source + ":" + i.Target
+}
+
+// Verify verifies that the include has a valid source pattern, a target which stays inside the deployment directory, and valid octal permissions.
+func (i FileInclude) Verify() error {
+	if i.Source == "" {
+		return fmt.Errorf("source is <empty>")
+	}
+
+	if _, err := filepath.Match(i.Source, ""); err != nil {
+		return fmt.Errorf("source \"%s\" is not a valid pattern: %s", i.Source, err)
+	}
+
+	if i.Target != "" {
+		if err := ValidateRemoteRelativePath(i.Target); err != nil {
+			return fmt.Errorf("target %s", err)
+		}
+	}
+
+	if i.Permissions != "" {
+		if err := validatePermissions(i.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IncludedFile is a local file to send to the server, resolved from a FileInclude.
+type IncludedFile struct {
+	LocalPath   string
+	RemotePath  string
+	Permissions string
+	Template    bool
+}
+
+// ResolveFileIncludes resolves the includes into the individual files to send to the server, with their remote paths relative to the deployment directory.
+// Sources are resolved relative to the provided path.
+// Returns an error if a source matches nothing, if a remote path would escape the deployment directory or overwrite a file generated by Sad, or if two files have the same remote path.
+func ResolveFileIncludes(fromPath string, includes []FileInclude) ([]IncludedFile, error) {
+	var includedFiles []IncludedFile
+	remotePaths := make(map[string]string)
+
+	for _, include := range includes {
+		if err := include.Verify(); err != nil {
+			return nil, fmt.Errorf("invalid include %s: %s", include, err)
+		}
+
+		files, err := resolveFileInclude(fromPath, include)
+
+		if err != nil {
+			return nil, fmt.Errorf("error resolving include %s: %s", include, err)
+		}
+
+		for _, file := range files {
+			if err := ValidateRemoteRelativePath(file.RemotePath); err != nil {
+				return nil, fmt.Errorf("error resolving include %s: remote path %s", include, err)
+			}
+
+			if isReservedRemotePath(file.RemotePath) {
+				return nil, fmt.Errorf("error resolving include %s: remote path \"%s\" is reserved for files generated by Sad", include, file.RemotePath)
+			}
+
+			if existing, ok := remotePaths[file.RemotePath]; ok {
+				return nil, fmt.Errorf("error resolving include %s: remote path \"%s\" is already used by %s", include, file.RemotePath, existing)
+			}
+
+			remotePaths[file.RemotePath] = file.LocalPath
+			includedFiles = append(includedFiles, file)
+		}
+	}
+
+	return includedFiles, nil
+}
+
+// ValidateRemoteRelativePath validates that a remote path is relative and stays inside the deployment directory.
+func ValidateRemoteRelativePath(remotePath string) error {
+	slashed := filepath.ToSlash(remotePath)
+	cleaned := path.Clean(slashed)
+
+	if path.IsAbs(slashed) || filepath.IsAbs(remotePath) {
+		return fmt.Errorf("\"%s\" should be relative to the deployment directory", remotePath)
+	}
+
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("\"%s\" escapes the deployment directory", remotePath)
+	}
+
+	return nil
+}
+
+func resolveFileInclude(fromPath string, include FileInclude) ([]IncludedFile, error) {
+	matches, err := filepath.Glob(filepath.Join(fromPath, include.Source))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match \"%s\" under path \"%s\"", include.Source, fromPath)
+	}
+
+	permissions := include.Permissions
+
+	if permissions == "" {
+		permissions = DefaultIncludedFilePermissions
+	}
+
+	isPattern := hasGlobMeta(include.Source)
+
+	var files []IncludedFile
+
+	for _, match := range matches {
+		info, err := os.Stat(match)
+
+		if err != nil {
+			return nil, err
+		}
+
+		relativePath, err := filepath.Rel(fromPath, match)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// By default, matches keep their local paths, and otherwise they are placed in the target directory.
+		// A single file (not matched by a pattern) is placed exactly at the target.
+		remotePath := filepath.ToSlash(relativePath)
+
+		if include.Target != "" {
+			remotePath = path.Clean(filepath.ToSlash(include.Target))
+
+			if isPattern {
+				remotePath = path.Join(remotePath, filepath.Base(match))
+			}
+		}
+
+		if !info.IsDir() {
+			files = append(files, IncludedFile{
+				LocalPath:   match,
+				RemotePath:  remotePath,
+				Permissions: permissions,
+				Template:    include.Template,
+			})
+
+			continue
+		}
+
+		dirFiles, err := resolveDirectory(match, remotePath, permissions, include.Template)
+
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, dirFiles...)
+	}
+
+	return files, nil
+}
+
+// resolveDirectory resolves all of the regular files in the directory tree, skipping ignored directories and symbolic links.
+func resolveDirectory(dirPath string, remoteDirPath string, permissions string, template bool) ([]IncludedFile, error) {
+	var files []IncludedFile
+
+	err := filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if filePath != dirPath && isIgnoredDirectory(info.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dirPath, filePath)
+
+		if err != nil {
+			return err
+		}
+
+		files = append(files, IncludedFile{
+			LocalPath:   filePath,
+			RemotePath:  path.Join(remoteDirPath, filepath.ToSlash(relativePath)),
+			Permissions: permissions,
+			Template:    template,
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].RemotePath < files[j].RemotePath
+	})
+
+	return files, nil
+}
+
+func isReservedRemotePath(remotePath string) bool {
+	cleaned := path.Clean(remotePath)
+
+	switch cleaned {
+	case RemoteDockerComposeFileName, RemoteDotEnvFileName, RemoteManifestFileName, RemoteLockFileName, RemoteReleaseFileName, RemoteAuditLogFileName, RemoteSecretsDirName:
+		return true
+	}
+
+	return strings.HasPrefix(cleaned, RemoteSecretsDirName+"/")
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+func validatePermissions(permissions string) error {
+	value, err := strconv.ParseUint(permissions, 8, 32)
+
+	if err != nil || value > 0777 {
+		return fmt.Errorf("permissions \"%s\" should be octal, such as 0644", permissions)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package sad_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestResolveFileIncludes(t *testing.T) {
+	tempDirPath := createIncludesTestDir(t)
+	defer os.RemoveAll(tempDirPath)
+
+	includes := []sad.FileInclude{
+		{Source: "nginx.conf"},
+		{Source: "certs/cert.pem", Target: "tls/server.pem", Permissions: "0600"},
+		{Source: "sql", Target: "init"},
+		{Source: "conf.d/*.conf", Target: "nginx"},
+	}
+
+	includedFiles, err := sad.ResolveFileIncludes(tempDirPath, includes)
+
+	if err != nil {
+		t.Fatalf("Error resolving file includes: %s", err)
+	}
+
+	expected := map[string]string{
+		"nginx.conf":           "0644",
+		"tls/server.pem":       "0600",
+		"init/01-schema.sql":   "0644",
+		"init/nested/seed.sql": "0644",
+		"nginx/a.conf":         "0644",
+		"nginx/b.conf":         "0644",
+	}
+
+	if len(includedFiles) != len(expected) {
+		t.Errorf("Expected %d included files but got %d: %v", len(expected), len(includedFiles), includedFiles)
+	}
+
+	for _, includedFile := range includedFiles {
+		permissions, ok := expected[includedFile.RemotePath]
+
+		if !ok {
+			t.Errorf("Unexpected included file with remote path %s", includedFile.RemotePath)
+			continue
+		}
+
+		testutils.CompareStrings("permissions of "+includedFile.RemotePath, permissions, includedFile.Permissions, t)
+	}
+}
+
+func TestResolveFileIncludesDefaultTarget(t *testing.T) {
+	tempDirPath := createIncludesTestDir(t)
+	defer os.RemoveAll(tempDirPath)
+
+	includes := []sad.FileInclude{
+		{Source: "conf.d/*.conf"},
+	}
+
+	includedFiles, err := sad.ResolveFileIncludes(tempDirPath, includes)
+
+	if err != nil {
+		t.Fatalf("Error resolving file includes: %s", err)
+	}
+
+	if len(includedFiles) != 2 {
+		t.Fatalf("Expected 2 included files but got %d: %v", len(includedFiles), includedFiles)
+	}
+
+	testutils.CompareStrings("remote path", "conf.d/a.conf", includedFiles[0].RemotePath, t)
+	testutils.CompareStrings("remote path", "conf.d/b.conf", includedFiles[1].RemotePath, t)
+}
+
+func TestResolveFileIncludesInvalid(t *testing.T) {
+	tempDirPath := createIncludesTestDir(t)
+	defer os.RemoveAll(tempDirPath)
+
+	invalid := map[string][]sad.FileInclude{
+		"escapes":   {{Source: "nginx.conf", Target: "../nginx.conf"}},
+		"absolute":  {{Source: "nginx.conf", Target: "/etc/nginx.conf"}},
+		"reserved":  {{Source: "nginx.conf", Target: ".env"}},
+		"secrets":   {{Source: "sql", Target: "secrets"}},
+		"missing":   {{Source: "missing.conf"}},
+		"duplicate": {{Source: "nginx.conf"}, {Source: "conf.d/a.conf", Target: "nginx.conf"}},
+	}
+
+	for name, includes := range invalid {
+		includedFiles, err := sad.ResolveFileIncludes(tempDirPath, includes)
+
+		if err == nil {
+			t.Errorf("Expected error resolving %s file includes but got nil", name)
+		}
+
+		if includedFiles != nil {
+			t.Errorf("Expected nil included files for %s file includes but got: %v", name, includedFiles)
+		}
+	}
+}
+
+func TestFileIncludeVerify(t *testing.T) {
+	valid := []sad.FileInclude{
+		{Source: "nginx.conf"},
+		{Source: "conf.d/*.conf", Target: "nginx/conf.d", Permissions: "0600"},
+	}
+
+	for _, include := range valid {
+		if err := include.Verify(); err != nil {
+			t.Errorf("Error verifying include %s: %s", include, err)
+		}
+	}
+
+	invalid := []sad.FileInclude{
+		{},
+		{Source: "["},
+		{Source: "nginx.conf", Target: "a/../../b"},
+		{Source: "nginx.conf", Permissions: "rw-r--r--"},
+		{Source: "nginx.conf", Permissions: "01777"},
+	}
+
+	for _, include := range invalid {
+		if err := include.Verify(); err == nil {
+			t.Errorf("Expected error verifying include %s but got nil", include)
+		}
+	}
+}
+
+func TestValidateRemoteRelativePath(t *testing.T) {
+	valid := []string{
+		"nginx.conf",
+		"conf/nginx.conf",
+		"./conf/../nginx.conf",
+	}
+
+	for _, remotePath := range valid {
+		if err := sad.ValidateRemoteRelativePath(remotePath); err != nil {
+			t.Errorf("Error validating remote path %s: %s", remotePath, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"..",
+		"../nginx.conf",
+		"conf/../../nginx.conf",
+		"/etc/nginx.conf",
+	}
+
+	for _, remotePath := range invalid {
+		if err := sad.ValidateRemoteRelativePath(remotePath); err == nil {
+			t.Errorf("Expected error validating remote path \"%s\" but got nil", remotePath)
+		}
+	}
+}
+
+func TestGetEntitiesForDeploymentFiles(t *testing.T) {
+	tempDirPath := createIncludesTestDir(t)
+	defer os.RemoveAll(tempDirPath)
+
+	composeFilePath := filepath.Join(tempDirPath, sad.LocalDockerComposeFileName)
+
+	if err := ioutil.WriteFile(composeFilePath, []byte("test"), 0755); err != nil {
+		t.Fatalf("Error writing to temp file \"%s\", %s", composeFilePath, err)
+	}
+
+	opts := &sad.Options{
+		Image:   "user/repo",
+		Digest:  "abc123",
+		Channel: "beta",
+		Files: []sad.FileInclude{
+			{Source: "certs/cert.pem", Target: "tls/server.pem", Permissions: "0600"},
+		},
+	}
+
+	composeFiles := findComposeFiles(tempDirPath, opts, t)
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, composeFiles, getDeploymentEnv(composeFiles, opts, t), opts)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
+	if err != nil {
+		t.Fatalf("Error getting files for deployment: %s", err)
+	}
+
+	reader, ok := readerMap["tls/server.pem"]
+
+	if !ok {
+		t.Fatalf("Expected a reader for the included file but got readers for: %v", readerMap)
+	}
+
+	permissionedReader, ok := reader.(sad.PermissionedReader)
+
+	if !ok {
+		t.Fatalf("Expected the included file reader to have permissions")
+	}
+
+	testutils.CompareStrings("permissions", "0600", permissionedReader.Permissions(), t)
+	testutils.CompareStrings("included file", "cert", testutils.ReadFromReader("included file", reader, t), t)
+}
+
+func createIncludesTestDir(t *testing.T) string {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	filePaths := map[string]string{
+		"nginx.conf":               "nginx",
+		"certs/cert.pem":           "cert",
+		"sql/01-schema.sql":        "schema",
+		"sql/nested/seed.sql":      "seed",
+		"sql/node_modules/foo.sql": "ignored",
+		"conf.d/a.conf":            "a",
+		"conf.d/b.conf":            "b",
+	}
+
+	for filePath, content := range filePaths {
+		fullPath := filepath.Join(tempDirPath, filepath.FromSlash(filePath))
+
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Error creating temp dir for \"%s\", %s", fullPath, err)
+		}
+
+		if err := ioutil.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing to temp file \"%s\", %s", fullPath, err)
+		}
+	}
+
+	return tempDirPath
+}
@@ -0,0 +1,150 @@
+package testutils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os/exec"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// StartLocalSSHServer starts an SSH server for testing which runs every command on the local machine with "sh -c", and connects to it.
+// The server accepts any user without authentication, and it is stopped when the test finishes.
+// Returns a client connected to the server.
+func StartLocalSSHServer(t *testing.T) *ssh.Client {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Error generating SSH host key: %s", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(hostKey)
+
+	if err != nil {
+		t.Fatalf("Error creating SSH host key signer: %s", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		NoClientAuth: true,
+	}
+
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Error listening for SSH connections: %s", err)
+	}
+
+	go acceptSSHConnections(listener, serverConfig)
+
+	clientConfig := &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), clientConfig)
+
+	if err != nil {
+		listener.Close()
+		t.Fatalf("Error connecting to SSH server: %s", err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		listener.Close()
+	})
+
+	return client
+}
+
+func acceptSSHConnections(listener net.Listener, serverConfig *ssh.ServerConfig) {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go serveSSHConnection(conn, serverConfig)
+	}
+}
+
+func serveSSHConnection(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+
+		if err != nil {
+			continue
+		}
+
+		go serveSSHSession(channel, channelRequests)
+	}
+}
+
+// serveSSHSession runs the command of the first exec request of the session, and replies to every other request with a failure.
+func serveSSHSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			request.Reply(false, nil)
+			continue
+		}
+
+		var payload struct {
+			Command string
+		}
+
+		if err := ssh.Unmarshal(request.Payload, &payload); err != nil {
+			request.Reply(false, nil)
+			continue
+		}
+
+		request.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+
+		status := 0
+
+		if err := cmd.Run(); err != nil {
+			status = 1
+
+			var exitError *exec.ExitError
+
+			if errors.As(err, &exitError) {
+				status = exitError.ExitCode()
+			}
+		}
+
+		exitStatus := struct {
+			Status uint32
+		}{
+			Status: uint32(status),
+		}
+
+		channel.SendRequest("exit-status", false, ssh.Marshal(&exitStatus))
+
+		return
+	}
+}
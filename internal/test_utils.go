@@ -18,33 +18,82 @@ import (
 
 // StringOptions represents all options as strings.
 type StringOptions struct {
-	Registry   string
-	Image      string
-	Digest     string
-	Server     string
-	Username   string
-	RootDir    string
-	PrivateKey string
-	Channel    string
-	Path       string
-	EnvVars    string
-	Debug      string
+	Registry         string
+	RegistryUsername string
+	RegistryPassword string
+	RegistryLogout   string
+	Image            string
+	Digest           string
+	Tag              string
+	Server           string
+	Username         string
+	RootDir          string
+	PrivateKey       string
+	Channel          string
+	Path             string
+	EnvVars          string
+	EnvFiles         string
+	SecretVars       string
+	ComposeFiles     string
+	Sync             string
+	LockTimeout      string
+	HistoryRetention string
+	Template         string
+	Debug            string
 }
 
 // FromOptions converts options into string options.
 func (stringOpts *StringOptions) FromOptions(opts *sad.Options) {
 	stringOpts.Registry = opts.Registry
+	stringOpts.RegistryUsername = opts.RegistryUsername
+	stringOpts.RegistryPassword = opts.RegistryPassword
+	stringOpts.RegistryLogout = strconv.FormatBool(opts.RegistryLogout)
 	stringOpts.Image = opts.Image
 	stringOpts.Digest = opts.Digest
+	stringOpts.Tag = opts.Tag
 	stringOpts.Server = opts.Server.String()
 	stringOpts.Username = opts.Username
 	stringOpts.RootDir = opts.RootDir
 	stringOpts.PrivateKey = opts.PrivateKey.ToBase64PEMString()
 	stringOpts.Channel = opts.Channel
 	stringOpts.EnvVars = strings.Join(opts.EnvVars, ",")
+	stringOpts.EnvFiles = strings.Join(opts.EnvFiles, ",")
+	stringOpts.SecretVars = strings.Join(opts.SecretVars, ",")
+	stringOpts.ComposeFiles = strings.Join(opts.ComposeFiles, ",")
+	stringOpts.Sync = opts.Sync
+	stringOpts.LockTimeout = opts.LockTimeout
+	stringOpts.HistoryRetention = strconv.Itoa(opts.HistoryRetention)
+	stringOpts.Template = strconv.FormatBool(opts.Template)
 	stringOpts.Debug = strconv.FormatBool(opts.Debug)
 }
 
+// Values gets the string options keyed by option name, see sad.Options.FromStringValues.
+func (stringOpts *StringOptions) Values() map[string]string {
+	return map[string]string{
+		"registry":         stringOpts.Registry,
+		"registryUsername": stringOpts.RegistryUsername,
+		"registryPassword": stringOpts.RegistryPassword,
+		"registryLogout":   stringOpts.RegistryLogout,
+		"image":            stringOpts.Image,
+		"digest":           stringOpts.Digest,
+		"tag":              stringOpts.Tag,
+		"server":           stringOpts.Server,
+		"username":         stringOpts.Username,
+		"rootDir":          stringOpts.RootDir,
+		"privateKey":       stringOpts.PrivateKey,
+		"channel":          stringOpts.Channel,
+		"envVars":          stringOpts.EnvVars,
+		"envFiles":         stringOpts.EnvFiles,
+		"secretVars":       stringOpts.SecretVars,
+		"composeFiles":     stringOpts.ComposeFiles,
+		"sync":             stringOpts.Sync,
+		"lockTimeout":      stringOpts.LockTimeout,
+		"historyRetention": stringOpts.HistoryRetention,
+		"template":         stringOpts.Template,
+		"debug":            stringOpts.Debug,
+	}
+}
+
 // SetEnv sets environment variables for all string options.
 // UnsetEnv should be called after.
 func (stringOpts *StringOptions) SetEnv() {
@@ -68,19 +117,37 @@ func GetTestOpts() sad.Options {
 	randSize := 5
 
 	testOpts := sad.Options{
-		Registry:   randString(randSize),
-		Image:      randString(randSize),
-		Digest:     randString(randSize),
-		Server:     net.ParseIP("1.2.3.4"),
-		Username:   randString(randSize),
-		RootDir:    randString(randSize),
-		PrivateKey: rsaPrivateKey,
-		Channel:    randString(randSize),
+		Registry:         randString(randSize),
+		RegistryUsername: randString(randSize),
+		RegistryPassword: randString(randSize),
+		RegistryLogout:   true,
+		Image:            randLowerString(randSize),
+		Digest:           "sha256:" + randHexString(64),
+		Tag:              randString(randSize),
+		Server:           net.ParseIP("1.2.3.4"),
+		Username:         randString(randSize),
+		RootDir:          randString(randSize),
+		PrivateKey:       rsaPrivateKey,
+		Channel:          randString(randSize),
 		EnvVars: []string{
 			randString(randSize),
 			randString(randSize),
 		},
-		Debug: true,
+		EnvFiles: []string{
+			randString(randSize),
+		},
+		SecretVars: []string{
+			randString(randSize),
+		},
+		ComposeFiles: []string{
+			randString(randSize),
+			randString(randSize),
+		},
+		Sync:             sad.SyncModeChanged,
+		LockTimeout:      "90s",
+		HistoryRetention: 20,
+		Template:         true,
+		Debug:            true,
 	}
 
 	return testOpts
@@ -99,10 +166,20 @@ func GenerateRSAPrivateKey() sad.RSAPrivateKey {
 func CompareOpts(expectedOpts sad.Options, actualOpts sad.Options, t *testing.T) {
 	CompareStrings("registry", expectedOpts.Registry, actualOpts.Registry, t)
 
+	CompareStrings("registry username", expectedOpts.RegistryUsername, actualOpts.RegistryUsername, t)
+
+	CompareStrings("registry password", expectedOpts.RegistryPassword, actualOpts.RegistryPassword, t)
+
+	if expectedOpts.RegistryLogout != actualOpts.RegistryLogout {
+		t.Errorf("Expected registry logout %t but got %t", expectedOpts.RegistryLogout, actualOpts.RegistryLogout)
+	}
+
 	CompareStrings("image", expectedOpts.Image, actualOpts.Image, t)
 
 	CompareStrings("digest", expectedOpts.Digest, actualOpts.Digest, t)
 
+	CompareStrings("tag", expectedOpts.Tag, actualOpts.Tag, t)
+
 	if !actualOpts.Server.Equal(expectedOpts.Server) {
 		t.Errorf("Expected server IP %s but got %s", expectedOpts.Server, actualOpts.Server)
 	}
@@ -119,13 +196,85 @@ func CompareOpts(expectedOpts sad.Options, actualOpts sad.Options, t *testing.T)
 
 	compareSlices("environment variables", expectedOpts.EnvVars, actualOpts.EnvVars, t)
 
+	compareSlices("environment files", expectedOpts.EnvFiles, actualOpts.EnvFiles, t)
+
+	compareSlices("secret variables", expectedOpts.SecretVars, actualOpts.SecretVars, t)
+
+	compareSlices("compose files", expectedOpts.ComposeFiles, actualOpts.ComposeFiles, t)
+
+	CompareStrings("sync", expectedOpts.Sync, actualOpts.Sync, t)
+	CompareStrings("lock timeout", expectedOpts.LockTimeout, actualOpts.LockTimeout, t)
+
+	if expectedOpts.HistoryRetention != actualOpts.HistoryRetention {
+		t.Errorf("Expected history retention %d but got %d", expectedOpts.HistoryRetention, actualOpts.HistoryRetention)
+	}
+
+	if expectedOpts.Template != actualOpts.Template {
+		t.Errorf("Expected template %t but got %t", expectedOpts.Template, actualOpts.Template)
+	}
+
+	if len(expectedOpts.EnvValues) != len(actualOpts.EnvValues) {
+		t.Errorf("Expected environment values %s but got %s", expectedOpts.EnvValues, actualOpts.EnvValues)
+	}
+
+	for variableName, expectedValue := range expectedOpts.EnvValues {
+		CompareStrings("environment value "+variableName, expectedValue, actualOpts.EnvValues[variableName], t)
+	}
+
+	if len(expectedOpts.Files) != len(actualOpts.Files) {
+		t.Errorf("Expected files %v but got %v", expectedOpts.Files, actualOpts.Files)
+	} else {
+		for i, expectedInclude := range expectedOpts.Files {
+			if expectedInclude != actualOpts.Files[i] {
+				t.Errorf("Expected file include %v but got %v", expectedInclude, actualOpts.Files[i])
+			}
+		}
+	}
+
+	if len(expectedOpts.Hooks) != len(actualOpts.Hooks) {
+		t.Errorf("Expected hooks %v but got %v", expectedOpts.Hooks, actualOpts.Hooks)
+	} else {
+		for phase, expectedHooks := range expectedOpts.Hooks {
+			actualHooks := actualOpts.Hooks[phase]
+
+			if len(expectedHooks) != len(actualHooks) {
+				t.Errorf("Expected %s hooks %v but got %v", phase, expectedHooks, actualHooks)
+				continue
+			}
+
+			for i, expectedHook := range expectedHooks {
+				if expectedHook != actualHooks[i] {
+					t.Errorf("Expected %s hook %v but got %v", phase, expectedHook, actualHooks[i])
+				}
+			}
+		}
+	}
+
 	if expectedOpts.Debug != actualOpts.Debug {
 		t.Errorf("Expected debug %t but got %t", expectedOpts.Debug, actualOpts.Debug)
 	}
+
+	if len(expectedOpts.Channels) != len(actualOpts.Channels) {
+		t.Errorf("Expected %d channel profiles but got %d", len(expectedOpts.Channels), len(actualOpts.Channels))
+	}
+
+	for channel, expectedProfile := range expectedOpts.Channels {
+		actualProfile, ok := actualOpts.Channels[channel]
+
+		if !ok {
+			t.Errorf("Expected channel profile %s but it was missing", channel)
+			continue
+		}
+
+		if expectedProfile != nil && actualProfile != nil {
+			CompareOpts(*expectedProfile, *actualProfile, t)
+		}
+	}
 }
 
 // CloneOptions clones options into other options.
 // The options to clone into should ideally be empty.
+// The registry password is copied separately since it is never marshaled to JSON.
 func CloneOptions(optionsToClone *sad.Options, optionsToCloneInto *sad.Options) error {
 	data, err := json.Marshal(optionsToClone)
 	if err != nil {
@@ -137,6 +286,8 @@ func CloneOptions(optionsToClone *sad.Options, optionsToCloneInto *sad.Options)
 		return err
 	}
 
+	optionsToCloneInto.RegistryPassword = optionsToClone.RegistryPassword
+
 	return nil
 }
 
@@ -256,18 +407,42 @@ func randString(n int) string {
 	return string(b)
 }
 
+func randLowerString(n int) string {
+	return strings.ToLower(randString(n))
+}
+
+func randHexString(n int) string {
+	var hexDigits = []rune("0123456789abcdef")
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = hexDigits[mathrand.Intn(len(hexDigits))]
+	}
+	return string(b)
+}
+
 func (stringOpts *StringOptions) getEnvVarsAndValues() ([]string, map[string]string) {
 	variablesToValues := map[string]string{
-		"REGISTRY":    stringOpts.Registry,
-		"IMAGE":       stringOpts.Image,
-		"DIGEST":      stringOpts.Digest,
-		"SERVER":      stringOpts.Server,
-		"USERNAME":    stringOpts.Username,
-		"ROOT_DIR":    stringOpts.RootDir,
-		"PRIVATE_KEY": stringOpts.PrivateKey,
-		"CHANNEL":     stringOpts.Channel,
-		"ENV_VARS":    stringOpts.EnvVars,
-		"DEBUG":       stringOpts.Debug,
+		"REGISTRY":          stringOpts.Registry,
+		"REGISTRY_USERNAME": stringOpts.RegistryUsername,
+		"REGISTRY_PASSWORD": stringOpts.RegistryPassword,
+		"REGISTRY_LOGOUT":   stringOpts.RegistryLogout,
+		"IMAGE":             stringOpts.Image,
+		"DIGEST":            stringOpts.Digest,
+		"TAG":               stringOpts.Tag,
+		"SERVER":            stringOpts.Server,
+		"USERNAME":          stringOpts.Username,
+		"ROOT_DIR":          stringOpts.RootDir,
+		"PRIVATE_KEY":       stringOpts.PrivateKey,
+		"CHANNEL":           stringOpts.Channel,
+		"ENV_VARS":          stringOpts.EnvVars,
+		"ENV_FILES":         stringOpts.EnvFiles,
+		"SECRET_VARS":       stringOpts.SecretVars,
+		"COMPOSE_FILES":     stringOpts.ComposeFiles,
+		"SYNC":              stringOpts.Sync,
+		"LOCK_TIMEOUT":      stringOpts.LockTimeout,
+		"HISTORY_RETENTION": stringOpts.HistoryRetention,
+		"TEMPLATE":          stringOpts.Template,
+		"DEBUG":             stringOpts.Debug,
 	}
 
 	variables := make([]string, 0, len(variablesToValues))
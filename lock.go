@@ -0,0 +1,237 @@
+package sad
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteLockFileName is the name of the lock file in the deployment directory, which exists while a deployment is in progress.
+var RemoteLockFileName string = ".sad-lock.json"
+
+// DefaultLockTimeout is how long to wait for another deployment to release the lock by default.
+var DefaultLockTimeout string = "5m"
+
+// LockStaleAfter is how old a lock must be before it is considered stale and taken over, such as when Sad was killed in the middle of a deployment.
+var LockStaleAfter time.Duration = time.Hour
+
+// LockRetryInterval is how long to wait between attempts to acquire a lock held by another deployment.
+var LockRetryInterval time.Duration = 5 * time.Second
+
+// Lock describes who holds the lock of a deployment directory.
+// The ID is random, so that a deployment only ever releases its own lock.
+type Lock struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NewLock creates a lock owned by the current user and process on this machine, with the current time.
+func NewLock() (*Lock, error) {
+	idBytes := make([]byte, 16)
+
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("error generating lock ID: %s", err)
+	}
+
+	owner, host := getLocalOwner()
+
+	lock := &Lock{
+		ID:        hex.EncodeToString(idBytes),
+		Owner:     owner,
+		Host:      host,
+		PID:       os.Getpid(),
+		Timestamp: time.Now().UTC(),
+	}
+
+	return lock, nil
+}
+
+// String describes who holds the lock and since when, such as "ci@runner-1 (PID 123) since 2021-09-01T12:00:00Z".
+func (l *Lock) String() string {
+	return fmt.Sprintf("%s@%s (PID %d) since %s", l.Owner, l.Host, l.PID, l.Timestamp.Format(time.RFC3339))
+}
+
+// IsStale checks whether the lock was taken at least LockStaleAfter before the specified time.
+func (l *Lock) IsStale(now time.Time) bool {
+	return now.Sub(l.Timestamp) >= LockStaleAfter
+}
+
+// ParseLock parses the content of a lock file.
+func ParseLock(content string) (*Lock, error) {
+	var lock Lock
+
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &lock); err != nil {
+		return nil, fmt.Errorf("error parsing lock file: %s", err)
+	}
+
+	if lock.ID == "" {
+		return nil, fmt.Errorf("lock file has no ID")
+	}
+
+	return &lock, nil
+}
+
+// ParseLockTimeout parses a lock timeout, such as "90s" or "10m".
+// Returns an error if the timeout is not a valid duration or it is negative.
+func ParseLockTimeout(timeout string) (time.Duration, error) {
+	duration, err := time.ParseDuration(timeout)
+
+	if err != nil {
+		return 0, fmt.Errorf("\"%s\" is not a valid duration such as 10m", timeout)
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("\"%s\" is negative", timeout)
+	}
+
+	return duration, nil
+}
+
+// AcquireLock acquires the lock of the deployment directory on the server, retrying every LockRetryInterval while another deployment holds it until the timeout passes.
+// The lock file is created atomically, so only one deployment can hold the lock at a time.
+// If the existing lock is stale (see Lock.IsStale), it is removed and the lock is taken over.
+// Returns the stale lock which was taken over, if any, or an error describing who holds the lock if it could not be acquired in time.
+func AcquireLock(sshClient *ssh.Client, remotePath string, lock *Lock, timeout time.Duration) (*Lock, error) {
+	data, err := json.Marshal(lock)
+
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling lock: %s", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	var staleLock *Lock
+	released := false
+
+	for {
+		_, createErr := SSHRunCommandWithStdin(sshClient, GetCreateLockCommand(remotePath), strings.NewReader(string(data)))
+
+		if createErr == nil {
+			return staleLock, nil
+		}
+
+		output, err := SSHRunCommand(sshClient, GetReadLockIfExistsCommand(remotePath))
+
+		if err != nil {
+			return nil, fmt.Errorf("error creating lock file: %s", createErr)
+		}
+
+		// The lock may have been released right after creating it failed, so creating it is tried again.
+		// If the lock is still missing after that, creating it fails for another reason.
+		if strings.TrimSpace(output) == "" {
+			if released {
+				return nil, fmt.Errorf("error creating lock file: %s", createErr)
+			}
+
+			released = true
+			continue
+		}
+
+		released = false
+
+		existing, err := ParseLock(output)
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading existing lock: %s, remove it with unlock -force if no deployment is in progress", err)
+		}
+
+		if existing.IsStale(time.Now()) {
+			if _, err := SSHRunCommand(sshClient, GetReleaseLockCommand(remotePath, existing.ID)); err != nil {
+				return nil, fmt.Errorf("error removing stale lock held by %s: %s", existing, err)
+			}
+
+			staleLock = existing
+			continue
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("deployment is locked by %s", existing)
+		}
+
+		time.Sleep(LockRetryInterval)
+	}
+}
+
+// ReleaseLock releases the lock of the deployment directory on the server, but only if it is still held by the specified lock.
+func ReleaseLock(sshClient *ssh.Client, remotePath string, lock *Lock) error {
+	_, err := SSHRunCommand(sshClient, GetReleaseLockCommand(remotePath, lock.ID))
+
+	return err
+}
+
+// ReadLock reads the lock of the deployment directory on the server.
+// Returns nil if the deployment is not locked.
+func ReadLock(sshClient *ssh.Client, remotePath string) (*Lock, error) {
+	output, err := SSHRunCommand(sshClient, GetReadLockIfExistsCommand(remotePath))
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading lock file: %s", err)
+	}
+
+	if strings.TrimSpace(output) == "" {
+		return nil, nil
+	}
+
+	return ParseLock(output)
+}
+
+// GetCreateLockCommand gets the command which atomically creates the lock file in the deployment directory from its standard input.
+// The command fails if the lock file already exists.
+func GetCreateLockCommand(remotePath string) string {
+	return fmt.Sprintf("cd %s && (set -C && cat > %s)", shellQuote(remotePath), shellQuote(RemoteLockFileName))
+}
+
+// GetReadLockCommand gets the command which prints the lock file in the deployment directory, which fails if it doesn't exist.
+func GetReadLockCommand(remotePath string) string {
+	return fmt.Sprintf("cat %s", shellQuote(remotePath+"/"+RemoteLockFileName))
+}
+
+// GetReadLockIfExistsCommand gets the command which prints the lock file in the deployment directory if it exists.
+func GetReadLockIfExistsCommand(remotePath string) string {
+	return getReadIfExistsCommand(remotePath + "/" + RemoteLockFileName)
+}
+
+// GetReleaseLockCommand gets the command which removes the lock file in the deployment directory only if it contains the specified lock ID.
+func GetReleaseLockCommand(remotePath string, id string) string {
+	lockPath := shellQuote(remotePath + "/" + RemoteLockFileName)
+
+	return fmt.Sprintf("if grep -qF %s %s 2>/dev/null; then rm -f %s; fi", shellQuote(id), lockPath, lockPath)
+}
+
+// getWhileLockedCommand gets the command which runs the specified command only if the lock file in the deployment directory contains the specified lock ID, and fails otherwise.
+func getWhileLockedCommand(remotePath string, id string, cmd string) string {
+	lockPath := shellQuote(remotePath + "/" + RemoteLockFileName)
+
+	return fmt.Sprintf("if grep -qF %s %s 2>/dev/null; then %s; else echo 'deployment lock is not held' >&2; exit 1; fi", shellQuote(id), lockPath, cmd)
+}
+
+// GetRemoveLockCommand gets the command which removes the lock file in the deployment directory, regardless of who holds it.
+func GetRemoveLockCommand(remotePath string) string {
+	return fmt.Sprintf("rm -f %s", shellQuote(remotePath+"/"+RemoteLockFileName))
+}
+
+// getLocalOwner gets the name of the current user and the host name of this machine, or "unknown" for either if it can't be found.
+func getLocalOwner() (string, string) {
+	owner := "unknown"
+
+	if currentUser, err := user.Current(); err == nil {
+		owner = currentUser.Username
+	}
+
+	host, err := os.Hostname()
+
+	if err != nil {
+		host = "unknown"
+	}
+
+	return owner, host
+}
@@ -0,0 +1,325 @@
+package sad_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestNewLock(t *testing.T) {
+	lock, err := sad.NewLock()
+
+	if err != nil {
+		t.Fatalf("Error creating lock: %s", err)
+	}
+
+	if len(lock.ID) != 32 {
+		t.Errorf("Expected lock ID with 32 characters but got: %s", lock.ID)
+	}
+
+	if lock.PID != os.Getpid() {
+		t.Errorf("Expected lock PID %d but got %d", os.Getpid(), lock.PID)
+	}
+
+	if lock.IsStale(time.Now()) {
+		t.Errorf("Expected new lock not to be stale")
+	}
+
+	other, err := sad.NewLock()
+
+	if err != nil {
+		t.Fatalf("Error creating lock: %s", err)
+	}
+
+	if lock.ID == other.ID {
+		t.Errorf("Expected locks to have different IDs but both got: %s", lock.ID)
+	}
+}
+
+func TestLockString(t *testing.T) {
+	lock := sad.Lock{
+		ID:        "abc123",
+		Owner:     "ci",
+		Host:      "runner-1",
+		PID:       123,
+		Timestamp: time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	testutils.CompareStrings("lock", "ci@runner-1 (PID 123) since 2021-09-01T12:00:00Z", lock.String(), t)
+}
+
+func TestLockIsStale(t *testing.T) {
+	now := time.Now()
+
+	lock := sad.Lock{
+		Timestamp: now.Add(-sad.LockStaleAfter),
+	}
+
+	if !lock.IsStale(now) {
+		t.Errorf("Expected lock taken %s ago to be stale", sad.LockStaleAfter)
+	}
+
+	lock.Timestamp = now.Add(-time.Minute)
+
+	if lock.IsStale(now) {
+		t.Errorf("Expected lock taken a minute ago not to be stale")
+	}
+}
+
+func TestParseLock(t *testing.T) {
+	lock, err := sad.ParseLock("{\"id\": \"abc123\", \"owner\": \"ci\", \"host\": \"runner-1\", \"pid\": 123, \"timestamp\": \"2021-09-01T12:00:00Z\"}\n")
+
+	if err != nil {
+		t.Fatalf("Error parsing lock: %s", err)
+	}
+
+	testutils.CompareStrings("lock", "ci@runner-1 (PID 123) since 2021-09-01T12:00:00Z", lock.String(), t)
+
+	invalid := []string{
+		"",
+		"locked",
+		"{\"owner\": \"ci\"}",
+	}
+
+	for _, content := range invalid {
+		if _, err := sad.ParseLock(content); err == nil {
+			t.Errorf("Expected error parsing lock \"%s\" but got nil", content)
+		}
+	}
+}
+
+func TestParseLockTimeout(t *testing.T) {
+	timeout, err := sad.ParseLockTimeout("90s")
+
+	if err != nil {
+		t.Fatalf("Error parsing lock timeout: %s", err)
+	}
+
+	if timeout != 90*time.Second {
+		t.Errorf("Expected lock timeout 1m30s but got %s", timeout)
+	}
+
+	for _, invalid := range []string{"10", "soon", "-1m"} {
+		if _, err := sad.ParseLockTimeout(invalid); err == nil {
+			t.Errorf("Expected error parsing lock timeout \"%s\" but got nil", invalid)
+		}
+	}
+}
+
+func TestLockCommands(t *testing.T) {
+	remotePath := "/srv/user-foo-beta"
+
+	testutils.CompareStrings("create command", "cd '/srv/user-foo-beta' && (set -C && cat > '.sad-lock.json')", sad.GetCreateLockCommand(remotePath), t)
+	testutils.CompareStrings("read command", "cat '/srv/user-foo-beta/.sad-lock.json'", sad.GetReadLockCommand(remotePath), t)
+	testutils.CompareStrings("read if exists command", "if [ -f '/srv/user-foo-beta/.sad-lock.json' ]; then cat '/srv/user-foo-beta/.sad-lock.json'; fi", sad.GetReadLockIfExistsCommand(remotePath), t)
+	testutils.CompareStrings("release command", "if grep -qF 'abc123' '/srv/user-foo-beta/.sad-lock.json' 2>/dev/null; then rm -f '/srv/user-foo-beta/.sad-lock.json'; fi", sad.GetReleaseLockCommand(remotePath, "abc123"), t)
+	testutils.CompareStrings("remove command", "rm -f '/srv/user-foo-beta/.sad-lock.json'", sad.GetRemoveLockCommand(remotePath), t)
+}
+
+func TestLockCommandsShell(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "sad-lock-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	lock, _ := sad.NewLock()
+	other, _ := sad.NewLock()
+
+	lockData, _ := json.Marshal(lock)
+	otherData, _ := json.Marshal(other)
+
+	runShell := func(cmd string, stdin string) error {
+		shell := exec.Command("sh", "-c", cmd)
+		shell.Stdin = strings.NewReader(stdin)
+		return shell.Run()
+	}
+
+	if err := runShell(sad.GetCreateLockCommand(tempDirPath), string(lockData)); err != nil {
+		t.Fatalf("Error creating lock file: %s", err)
+	}
+
+	if err := runShell(sad.GetCreateLockCommand(tempDirPath), string(otherData)); err == nil {
+		t.Errorf("Expected error creating lock file which already exists but got nil")
+	}
+
+	if err := runShell(sad.GetReleaseLockCommand(tempDirPath, other.ID), ""); err != nil {
+		t.Fatalf("Error releasing lock: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(tempDirPath, sad.RemoteLockFileName))
+
+	if err != nil {
+		t.Fatalf("Expected lock file to remain after releasing another lock but got: %s", err)
+	}
+
+	testutils.CompareStrings("lock file", string(lockData), string(content), t)
+
+	if err := runShell(sad.GetReleaseLockCommand(tempDirPath, lock.ID), ""); err != nil {
+		t.Fatalf("Error releasing lock: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDirPath, sad.RemoteLockFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected lock file to be removed but got: %v", err)
+	}
+}
+
+func TestAcquireLockTimeout(t *testing.T) {
+	sshClient := testutils.StartLocalSSHServer(t)
+	tempDirPath := createLockTestDir(t)
+
+	other := writeTestLockFile(tempDirPath, t)
+	lock, _ := sad.NewLock()
+
+	setLockRetryInterval(10*time.Millisecond, t)
+
+	_, err := sad.AcquireLock(sshClient, tempDirPath, lock, 50*time.Millisecond)
+
+	if err == nil || !strings.Contains(err.Error(), "locked by") {
+		t.Fatalf("Expected error acquiring a held lock but got: %v", err)
+	}
+
+	compareLockFile(tempDirPath, other, t)
+}
+
+func TestAcquireLockRetry(t *testing.T) {
+	sshClient := testutils.StartLocalSSHServer(t)
+	tempDirPath := createLockTestDir(t)
+
+	other := writeTestLockFile(tempDirPath, t)
+	lock, _ := sad.NewLock()
+
+	setLockRetryInterval(10*time.Millisecond, t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sad.ReleaseLock(sshClient, tempDirPath, other)
+	}()
+
+	staleLock, err := sad.AcquireLock(sshClient, tempDirPath, lock, 10*time.Second)
+
+	if err != nil {
+		t.Fatalf("Error acquiring lock after it was released: %s", err)
+	}
+
+	if staleLock != nil {
+		t.Errorf("Expected no stale lock but got: %s", staleLock)
+	}
+
+	compareLockFile(tempDirPath, lock, t)
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	sshClient := testutils.StartLocalSSHServer(t)
+	tempDirPath := createLockTestDir(t)
+
+	stale, _ := sad.NewLock()
+	stale.Timestamp = time.Now().Add(-sad.LockStaleAfter - time.Minute).UTC()
+	writeLockFile(tempDirPath, stale, t)
+
+	lock, _ := sad.NewLock()
+
+	staleLock, err := sad.AcquireLock(sshClient, tempDirPath, lock, 0)
+
+	if err != nil {
+		t.Fatalf("Error taking over stale lock: %s", err)
+	}
+
+	if staleLock == nil || staleLock.ID != stale.ID {
+		t.Errorf("Expected the stale lock %s to be taken over but got: %v", stale.ID, staleLock)
+	}
+
+	compareLockFile(tempDirPath, lock, t)
+}
+
+func TestReleaseLockOtherID(t *testing.T) {
+	sshClient := testutils.StartLocalSSHServer(t)
+	tempDirPath := createLockTestDir(t)
+
+	lock := writeTestLockFile(tempDirPath, t)
+	other, _ := sad.NewLock()
+
+	if err := sad.ReleaseLock(sshClient, tempDirPath, other); err != nil {
+		t.Fatalf("Error releasing lock: %s", err)
+	}
+
+	compareLockFile(tempDirPath, lock, t)
+
+	if err := sad.ReleaseLock(sshClient, tempDirPath, lock); err != nil {
+		t.Fatalf("Error releasing lock: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDirPath, sad.RemoteLockFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected lock file to be removed but got: %v", err)
+	}
+}
+
+func createLockTestDir(t *testing.T) string {
+	tempDirPath, err := ioutil.TempDir("", "sad-lock-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(tempDirPath)
+	})
+
+	return tempDirPath
+}
+
+func setLockRetryInterval(interval time.Duration, t *testing.T) {
+	previous := sad.LockRetryInterval
+	sad.LockRetryInterval = interval
+
+	t.Cleanup(func() {
+		sad.LockRetryInterval = previous
+	})
+}
+
+func compareLockFile(remotePath string, expected *sad.Lock, t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join(remotePath, sad.RemoteLockFileName))
+
+	if err != nil {
+		t.Fatalf("Error reading lock file: %s", err)
+	}
+
+	actual, err := sad.ParseLock(string(content))
+
+	if err != nil {
+		t.Fatalf("Error parsing lock file: %s", err)
+	}
+
+	testutils.CompareStrings("lock ID", expected.ID, actual.ID, t)
+}
+
+func writeTestLockFile(remotePath string, t *testing.T) *sad.Lock {
+	lock, err := sad.NewLock()
+
+	if err != nil {
+		t.Fatalf("Error creating lock: %s", err)
+	}
+
+	writeLockFile(remotePath, lock, t)
+
+	return lock
+}
+
+func writeLockFile(remotePath string, lock *sad.Lock, t *testing.T) {
+	data, _ := json.Marshal(lock)
+
+	if err := ioutil.WriteFile(filepath.Join(remotePath, sad.RemoteLockFileName), data, 0644); err != nil {
+		t.Fatalf("Error writing lock file: %s", err)
+	}
+}
@@ -0,0 +1,558 @@
+package sad
+
+import (
+	"flag"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// optionDefinition describes a single option: its names, where it can be configured from, and how to read its value.
+// Each option is defined once in optionDefinitions, and everything else which lists the options is derived from it.
+type optionDefinition struct {
+	// key is the name of the option as shown by the config command, which is also its config file key if config is true.
+	key string
+	// name is the name of the option as used in validation errors, such as "root directory".
+	name string
+	// flag and envVar are the command line flag and the environment variable which set the option, if any.
+	flag   string
+	envVar string
+	// config is whether the option can be set in the config file.
+	config bool
+	// usage describes the option in the help message of the command line flag.
+	usage string
+	// boolean options are set by their flag without a value, such as -debug.
+	boolean bool
+	// list options are comma-separated lists, which are explicitly set even when they are empty, see SetExplicitly.
+	list bool
+	// secret options have their values redacted when they are described.
+	secret     bool
+	value      func(o *Options) interface{}
+	isSet      func(o *Options) bool
+	fromString func(o *Options, value string) error
+}
+
+// source gets where the option can be configured from.
+func (d optionDefinition) source() OptionSource {
+	source := OptionSource{
+		Flag:   d.flag,
+		EnvVar: d.envVar,
+	}
+
+	if d.config {
+		source.ConfigKey = d.key
+	}
+
+	return source
+}
+
+var optionDefinitions = []optionDefinition{
+	{
+		key:    "registry",
+		name:   "registry",
+		flag:   "registry",
+		envVar: OptionEnvVarPrefix + "REGISTRY",
+		config: true,
+		usage:  "Docker image registry",
+		value:  func(o *Options) interface{} { return o.Registry },
+		isSet:  func(o *Options) bool { return o.Registry != "" },
+		fromString: func(o *Options, value string) error {
+			o.Registry = value
+			return nil
+		},
+	},
+	{
+		key:    "registryUsername",
+		name:   "registry username",
+		flag:   "registry-username",
+		envVar: OptionEnvVarPrefix + "REGISTRY_USERNAME",
+		config: true,
+		usage:  "User to login to the Docker image registry with, the password is read from " + OptionEnvVarPrefix + "REGISTRY_PASSWORD",
+		value:  func(o *Options) interface{} { return o.RegistryUsername },
+		isSet:  func(o *Options) bool { return o.RegistryUsername != "" },
+		fromString: func(o *Options, value string) error {
+			o.RegistryUsername = value
+			return nil
+		},
+	},
+	{
+		key:    "registryPassword",
+		name:   "registry password",
+		envVar: OptionEnvVarPrefix + "REGISTRY_PASSWORD",
+		secret: true,
+		value:  func(o *Options) interface{} { return o.RegistryPassword },
+		isSet:  func(o *Options) bool { return o.RegistryPassword != "" },
+		fromString: func(o *Options, value string) error {
+			o.RegistryPassword = value
+			return nil
+		},
+	},
+	{
+		key:     RegistryLogoutOption,
+		name:    "registry logout",
+		flag:    "registry-logout",
+		envVar:  OptionEnvVarPrefix + "REGISTRY_LOGOUT",
+		config:  true,
+		usage:   "Logout from the Docker image registry on the server after pulling",
+		boolean: true,
+		value:   func(o *Options) interface{} { return o.RegistryLogout },
+		isSet:   func(o *Options) bool { return o.RegistryLogout || o.IsExplicitlySet(RegistryLogoutOption) },
+		fromString: func(o *Options, value string) error {
+			return parseBoolOption(value, &o.RegistryLogout)
+		},
+	},
+	{
+		key:    "image",
+		name:   "image",
+		flag:   "image",
+		envVar: OptionEnvVarPrefix + "IMAGE",
+		config: true,
+		usage:  "Docker image to deploy",
+		value:  func(o *Options) interface{} { return o.Image },
+		isSet:  func(o *Options) bool { return o.Image != "" },
+		fromString: func(o *Options, value string) error {
+			o.Image = value
+			return nil
+		},
+	},
+	{
+		key:    "digest",
+		name:   "digest",
+		flag:   "digest",
+		envVar: OptionEnvVarPrefix + "DIGEST",
+		config: true,
+		usage:  "Docker image digest to deploy",
+		value:  func(o *Options) interface{} { return o.Digest },
+		isSet:  func(o *Options) bool { return o.Digest != "" },
+		fromString: func(o *Options, value string) error {
+			o.Digest = value
+			return nil
+		},
+	},
+	{
+		key:    "tag",
+		name:   "tag",
+		flag:   "tag",
+		envVar: OptionEnvVarPrefix + "TAG",
+		config: true,
+		usage:  "Docker image tag to resolve to a digest to deploy",
+		value:  func(o *Options) interface{} { return o.Tag },
+		isSet:  func(o *Options) bool { return o.Tag != "" },
+		fromString: func(o *Options, value string) error {
+			o.Tag = value
+			return nil
+		},
+	},
+	{
+		key:    "server",
+		name:   "server",
+		flag:   "server",
+		envVar: OptionEnvVarPrefix + "SERVER",
+		config: true,
+		usage:  "Server to deploy to",
+		value: func(o *Options) interface{} {
+			if o.Server == nil {
+				return ""
+			}
+
+			return o.Server.String()
+		},
+		isSet: func(o *Options) bool { return o.Server != nil },
+		fromString: func(o *Options, value string) error {
+			if value != "" {
+				o.Server = net.ParseIP(value)
+			}
+
+			return nil
+		},
+	},
+	{
+		key:    "username",
+		name:   "username",
+		flag:   "username",
+		envVar: OptionEnvVarPrefix + "USERNAME",
+		config: true,
+		usage:  "User to login to on the server",
+		value:  func(o *Options) interface{} { return o.Username },
+		isSet:  func(o *Options) bool { return o.Username != "" },
+		fromString: func(o *Options, value string) error {
+			o.Username = value
+			return nil
+		},
+	},
+	{
+		key:    "rootDir",
+		name:   "root directory",
+		flag:   "root-dir",
+		envVar: OptionEnvVarPrefix + "ROOT_DIR",
+		config: true,
+		usage:  "Root directory to deploy to on the server",
+		value:  func(o *Options) interface{} { return o.RootDir },
+		isSet:  func(o *Options) bool { return o.RootDir != "" },
+		fromString: func(o *Options, value string) error {
+			o.RootDir = value
+			return nil
+		},
+	},
+	{
+		key:    "privateKey",
+		name:   "private key",
+		flag:   "private-key",
+		envVar: OptionEnvVarPrefix + "PRIVATE_KEY",
+		config: true,
+		usage:  "Base64 encoded SSH private key to login to the user on the server",
+		secret: true,
+		value: func(o *Options) interface{} {
+			if o.PrivateKey.PrivateKey == nil {
+				return ""
+			}
+
+			return o.PrivateKey.ToBase64PEMString()
+		},
+		isSet: func(o *Options) bool { return o.PrivateKey.PrivateKey != nil },
+		fromString: func(o *Options, value string) error {
+			if value == "" {
+				return nil
+			}
+
+			return o.PrivateKey.ParseBase64PEMString(value)
+		},
+	},
+	{
+		key:    "channel",
+		name:   "channel",
+		flag:   "channel",
+		envVar: OptionEnvVarPrefix + "CHANNEL",
+		config: true,
+		usage:  "Deployment channel",
+		value:  func(o *Options) interface{} { return o.Channel },
+		isSet:  func(o *Options) bool { return o.Channel != "" },
+		fromString: func(o *Options, value string) error {
+			o.Channel = value
+			return nil
+		},
+	},
+	{
+		key:    EnvVarsOption,
+		name:   "environment variables",
+		flag:   "env-vars",
+		envVar: OptionEnvVarPrefix + "ENV_VARS",
+		config: true,
+		usage:  "Local environment variables to be injected into the app deployment, as NAME, NAME? to allow empty values, or NAME=default",
+		list:   true,
+		value:  func(o *Options) interface{} { return o.EnvVars },
+		isSet:  func(o *Options) bool { return len(o.EnvVars) != 0 || o.IsExplicitlySet(EnvVarsOption) },
+		fromString: func(o *Options, value string) error {
+			o.EnvVars = parseListOption(value)
+			return nil
+		},
+	},
+	{
+		key:    EnvFilesOption,
+		name:   "environment files",
+		flag:   "env-files",
+		envVar: OptionEnvVarPrefix + "ENV_FILES",
+		config: true,
+		usage:  "Local dotenv files whose variables are injected into the app deployment",
+		list:   true,
+		value:  func(o *Options) interface{} { return o.EnvFiles },
+		isSet:  func(o *Options) bool { return len(o.EnvFiles) != 0 || o.IsExplicitlySet(EnvFilesOption) },
+		fromString: func(o *Options, value string) error {
+			o.EnvFiles = parseListOption(value)
+			return nil
+		},
+	},
+	{
+		key:    "envValues",
+		name:   "environment values",
+		config: true,
+		value: func(o *Options) interface{} {
+			names := make([]string, 0, len(o.EnvValues))
+
+			for name := range o.EnvValues {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			return names
+		},
+		isSet: func(o *Options) bool { return len(o.EnvValues) != 0 },
+	},
+	{
+		key:    SecretVarsOption,
+		name:   "secret variables",
+		flag:   "secret-vars",
+		envVar: OptionEnvVarPrefix + "SECRET_VARS",
+		config: true,
+		usage:  "Deployment environment variables to be injected as Docker secret files instead of into the .env file",
+		list:   true,
+		value:  func(o *Options) interface{} { return o.SecretVars },
+		isSet:  func(o *Options) bool { return len(o.SecretVars) != 0 || o.IsExplicitlySet(SecretVarsOption) },
+		fromString: func(o *Options, value string) error {
+			o.SecretVars = parseListOption(value)
+			return nil
+		},
+	},
+	{
+		key:    ComposeFilesOption,
+		name:   "compose files",
+		flag:   "compose-files",
+		envVar: OptionEnvVarPrefix + "COMPOSE_FILES",
+		config: true,
+		usage:  "Local Docker Compose files to deploy in merge order, instead of " + LocalDockerComposeFileName + " and its channel override",
+		list:   true,
+		value:  func(o *Options) interface{} { return o.ComposeFiles },
+		isSet:  func(o *Options) bool { return len(o.ComposeFiles) != 0 || o.IsExplicitlySet(ComposeFilesOption) },
+		fromString: func(o *Options, value string) error {
+			o.ComposeFiles = parseListOption(value)
+			return nil
+		},
+	},
+	{
+		key:    "files",
+		name:   "files",
+		config: true,
+		value: func(o *Options) interface{} {
+			includes := make([]string, len(o.Files))
+
+			for i, include := range o.Files {
+				includes[i] = include.String()
+			}
+
+			return includes
+		},
+		isSet: func(o *Options) bool { return len(o.Files) != 0 },
+	},
+	{
+		key:    "hooks",
+		name:   "hooks",
+		config: true,
+		value: func(o *Options) interface{} {
+			var hooks []string
+
+			for _, phase := range HookPhases {
+				for _, hook := range o.Hooks[phase] {
+					hooks = append(hooks, phase+" "+hook.String())
+				}
+			}
+
+			return hooks
+		},
+		isSet: func(o *Options) bool { return len(o.Hooks) != 0 },
+	},
+	{
+		key:    "sync",
+		name:   "sync",
+		flag:   "sync",
+		envVar: OptionEnvVarPrefix + "SYNC",
+		config: true,
+		usage:  "How to send files to the server: " + strings.Join(SyncModes, ", "),
+		value:  func(o *Options) interface{} { return o.Sync },
+		isSet:  func(o *Options) bool { return o.Sync != "" },
+		fromString: func(o *Options, value string) error {
+			o.Sync = value
+			return nil
+		},
+	},
+	{
+		key:    "lockTimeout",
+		name:   "lock timeout",
+		flag:   "lock-timeout",
+		envVar: OptionEnvVarPrefix + "LOCK_TIMEOUT",
+		config: true,
+		usage:  "How long to wait for another deployment to release the deployment lock, such as 10m",
+		value:  func(o *Options) interface{} { return o.LockTimeout },
+		isSet:  func(o *Options) bool { return o.LockTimeout != "" },
+		fromString: func(o *Options, value string) error {
+			o.LockTimeout = value
+			return nil
+		},
+	},
+	{
+		key:    HistoryRetentionOption,
+		name:   "history retention",
+		flag:   "history-retention",
+		envVar: OptionEnvVarPrefix + "HISTORY_RETENTION",
+		config: true,
+		usage:  "Number of deployments to keep in the audit log on the server, or 0 to keep all of them",
+		value:  func(o *Options) interface{} { return o.HistoryRetention },
+		isSet:  func(o *Options) bool { return o.HistoryRetention != 0 || o.IsExplicitlySet(HistoryRetentionOption) },
+		fromString: func(o *Options, value string) error {
+			if value == "" {
+				return nil
+			}
+
+			retention, err := strconv.Atoi(value)
+			o.HistoryRetention = retention
+
+			return err
+		},
+	},
+	{
+		key:     TemplateOption,
+		name:    "template",
+		flag:    "template",
+		envVar:  OptionEnvVarPrefix + "TEMPLATE",
+		config:  true,
+		usage:   "Render the Docker Compose file as a Go template",
+		boolean: true,
+		value:   func(o *Options) interface{} { return o.Template },
+		isSet:   func(o *Options) bool { return o.Template || o.IsExplicitlySet(TemplateOption) },
+		fromString: func(o *Options, value string) error {
+			return parseBoolOption(value, &o.Template)
+		},
+	},
+	{
+		key:     DebugOption,
+		name:    "debug",
+		flag:    "debug",
+		envVar:  OptionEnvVarPrefix + "DEBUG",
+		config:  true,
+		usage:   "Debug mode",
+		boolean: true,
+		value:   func(o *Options) interface{} { return o.Debug },
+		isSet:   func(o *Options) bool { return o.Debug || o.IsExplicitlySet(DebugOption) },
+		fromString: func(o *Options, value string) error {
+			return parseBoolOption(value, &o.Debug)
+		},
+	},
+	{
+		key:    "channels",
+		name:   "channels",
+		config: true,
+		value: func(o *Options) interface{} {
+			channels := make([]string, 0, len(o.Channels))
+
+			for channel := range o.Channels {
+				channels = append(channels, channel)
+			}
+
+			sort.Strings(channels)
+
+			return channels
+		},
+		isSet: func(o *Options) bool { return len(o.Channels) != 0 },
+	},
+	{
+		key:    "ageKey",
+		name:   "age key",
+		envVar: OptionEnvVarPrefix + "AGE_KEY",
+		secret: true,
+		value:  func(o *Options) interface{} { return o.AgeKey },
+		isSet:  func(o *Options) bool { return o.AgeKey != "" },
+		fromString: func(o *Options, value string) error {
+			o.AgeKey = value
+			return nil
+		},
+	},
+	{
+		key:    "config",
+		name:   "config",
+		flag:   "config",
+		envVar: OptionEnvVarPrefix + "CONFIG",
+		usage:  "Path of the config file to use instead of searching for one",
+		value:  func(o *Options) interface{} { return o.Config },
+		isSet:  func(o *Options) bool { return o.Config != "" },
+		fromString: func(o *Options, value string) error {
+			o.Config = value
+			return nil
+		},
+	},
+}
+
+// DefineOptionFlags defines a command line flag for each option which can be set from the command line.
+// Boolean options are defined as boolean flags, and all other options as string flags which are parsed by FromStringValues.
+func DefineOptionFlags(flags *flag.FlagSet) {
+	for _, definition := range optionDefinitions {
+		if definition.flag == "" {
+			continue
+		}
+
+		if definition.boolean {
+			flags.Bool(definition.flag, false, definition.usage)
+		} else {
+			flags.String(definition.flag, "", definition.usage)
+		}
+	}
+}
+
+// GetOptionFlagValues gets the values of the option flags which were set on the command line after parsing, keyed by option name, see FromStringValues.
+// The flags must have been defined with DefineOptionFlags.
+func GetOptionFlagValues(flags *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+
+	flags.Visit(func(f *flag.Flag) {
+		for _, definition := range optionDefinitions {
+			if definition.flag != "" && definition.flag == f.Name {
+				values[definition.key] = f.Value.String()
+			}
+		}
+	})
+
+	return values
+}
+
+// getEnvOptionValues gets the values of the options which are set in the environment, keyed by option name, see FromStringValues.
+func getEnvOptionValues() map[string]string {
+	values := make(map[string]string)
+
+	for _, definition := range optionDefinitions {
+		if definition.envVar == "" {
+			continue
+		}
+
+		if value, ok := os.LookupEnv(definition.envVar); ok {
+			values[definition.key] = value
+		}
+	}
+
+	return values
+}
+
+// getOptionSources gets where each option can be configured from, keyed by the name of the option as used in validation errors.
+func getOptionSources() map[string]OptionSource {
+	sources := make(map[string]OptionSource, len(optionDefinitions))
+
+	for _, definition := range optionDefinitions {
+		sources[definition.name] = definition.source()
+	}
+
+	return sources
+}
+
+func getOptionDefinition(key string) (optionDefinition, bool) {
+	for _, definition := range optionDefinitions {
+		if definition.key == key {
+			return definition, true
+		}
+	}
+
+	return optionDefinition{}, false
+}
+
+func parseBoolOption(value string, field *bool) error {
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		return err
+	}
+
+	*field = parsed
+
+	return nil
+}
+
+func parseListOption(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
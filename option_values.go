@@ -0,0 +1,70 @@
+package sad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RedactedValue is shown in place of the values of secret options.
+var RedactedValue = "<redacted>"
+
+// OptionLayer is a named source of options, used to describe where the effective value of each option came from.
+type OptionLayer struct {
+	Source  string
+	Options *Options
+}
+
+// OptionValue describes the effective value of a single option and the source it came from.
+// The source is empty if the option is not set by any source.
+type OptionValue struct {
+	Name   string      `json:"name"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// String formats the value of the option for display, such as joining lists with commas.
+func (v OptionValue) String() string {
+	switch value := v.Value.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(value, ",")
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// DescribeOptions describes the effective value of each option in the merged options, along with the first layer which sets it.
+// The layers should be ordered from greatest to least precedence, matching the order in which they were merged.
+// The values of secret options such as the private key and the registry password are replaced by RedactedValue.
+func DescribeOptions(merged *Options, layers []OptionLayer) []OptionValue {
+	values := make([]OptionValue, len(optionDefinitions))
+
+	for i, definition := range optionDefinitions {
+		var source string
+
+		for _, layer := range layers {
+			if layer.Options != nil && definition.isSet(layer.Options) {
+				source = layer.Source
+				break
+			}
+		}
+
+		value := definition.value(merged)
+
+		if definition.secret && definition.isSet(merged) {
+			value = RedactedValue
+		}
+
+		values[i] = OptionValue{
+			Name:   definition.key,
+			Value:  value,
+			Source: source,
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,102 @@
+package sad_test
+
+import (
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestDescribeOptions(t *testing.T) {
+	commandLineOpts := sad.Options{
+		Image: "user/foo",
+	}
+	commandLineOpts.SetExplicitly(sad.DebugOption)
+
+	environmentOpts := sad.Options{
+		RegistryPassword: "secret",
+		PrivateKey:       testutils.GenerateRSAPrivateKey(),
+	}
+
+	configOpts := sad.Options{
+		Image:   "user/bar",
+		RootDir: "/srv",
+		Debug:   true,
+	}
+
+	layers := []sad.OptionLayer{
+		{Source: "command line", Options: commandLineOpts.Clone()},
+		{Source: "environment", Options: environmentOpts.Clone()},
+		{Source: "config file", Options: configOpts.Clone()},
+		{Source: "default", Options: sad.GetDefaultOptions()},
+	}
+
+	merged := commandLineOpts.Clone()
+	merged.Merge(&environmentOpts)
+	merged.Merge(&configOpts)
+	merged.MergeDefaults()
+
+	values := sad.DescribeOptions(merged, layers)
+
+	valuesByName := make(map[string]sad.OptionValue)
+
+	for _, value := range values {
+		valuesByName[value.Name] = value
+	}
+
+	expected := []struct {
+		name   string
+		value  string
+		source string
+	}{
+		{"image", "user/foo", "command line"},
+		{"debug", "false", "command line"},
+		{"registryPassword", sad.RedactedValue, "environment"},
+		{"privateKey", sad.RedactedValue, "environment"},
+		{"rootDir", "/srv", "config file"},
+		{"channel", sad.DefaultChannel, "default"},
+		{"registry", "", ""},
+		{"envVars", "", ""},
+	}
+
+	for _, e := range expected {
+		value, ok := valuesByName[e.name]
+
+		if !ok {
+			t.Errorf("Expected option %s to be described", e.name)
+			continue
+		}
+
+		testutils.CompareStrings(e.name+" value", e.value, value.String(), t)
+		testutils.CompareStrings(e.name+" source", e.source, value.Source, t)
+	}
+}
+
+func TestOptionSources(t *testing.T) {
+	expected := map[string]sad.OptionSource{
+		"root directory":    {Flag: "root-dir", EnvVar: "SAD_ROOT_DIR", ConfigKey: "rootDir"},
+		"registry password": {EnvVar: "SAD_REGISTRY_PASSWORD"},
+		"hooks":             {ConfigKey: "hooks"},
+		"config":            {Flag: "config", EnvVar: "SAD_CONFIG"},
+	}
+
+	for name, expectedSource := range expected {
+		source, ok := sad.OptionSources[name]
+
+		if !ok {
+			t.Errorf("Expected a source for option %s", name)
+			continue
+		}
+
+		if source != expectedSource {
+			t.Errorf("Expected source %+v for option %s but got %+v", expectedSource, name, source)
+		}
+	}
+
+	described := sad.DescribeOptions(&sad.Options{}, nil)
+
+	if len(described) != len(sad.OptionSources) {
+		t.Errorf("Expected %d described options to match the %d option sources", len(described), len(sad.OptionSources))
+	}
+}
@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
 )
 
 // OptionEnvVarPrefix represents the prefix that all environment variables representing options should have to be read properly.
@@ -17,27 +22,104 @@ var OptionEnvVarPrefix = "SAD_"
 // DeploymentEnvVarPrefix represents the prefix that all dynamic environment variables which will be injected into the deployment should have to be read properly.
 var DeploymentEnvVarPrefix = OptionEnvVarPrefix + "DEPLOY_"
 
+// DefaultChannel is the channel used when no channel is specified.
+var DefaultChannel = "beta"
+
+// RegistryLogoutOption, EnvVarsOption, EnvFilesOption, SecretVarsOption, ComposeFilesOption, HistoryRetentionOption, TemplateOption, and DebugOption are the names of the options whose zero values can be set explicitly.
+// Explicitly set options are kept when merging, even if they are false or empty.
+// The names match the config file keys.
+var (
+	RegistryLogoutOption   = "registryLogout"
+	EnvVarsOption          = "envVars"
+	EnvFilesOption         = "envFiles"
+	SecretVarsOption       = "secretVars"
+	ComposeFilesOption     = "composeFiles"
+	HistoryRetentionOption = "historyRetention"
+	TemplateOption         = "template"
+	DebugOption            = "debug"
+)
+
+var explicitOptionNames = []string{
+	RegistryLogoutOption,
+	EnvVarsOption,
+	EnvFilesOption,
+	SecretVarsOption,
+	ComposeFilesOption,
+	HistoryRetentionOption,
+	TemplateOption,
+	DebugOption,
+}
+
 // Options for deployment.
 type Options struct {
-	Registry   string
-	Image      string
-	Digest     string
-	Server     net.IP
-	Username   string
-	RootDir    string
-	PrivateKey RSAPrivateKey
-	Channel    string
-	EnvVars    []string
-	Debug      bool
+	Registry         string              `yaml:"registry,omitempty" toml:"registry,omitempty"`
+	RegistryUsername string              `yaml:"registryUsername,omitempty" toml:"registryUsername,omitempty"`
+	RegistryPassword string              `json:"-" yaml:"-" toml:"-"`
+	RegistryLogout   bool                `yaml:"registryLogout,omitempty" toml:"registryLogout,omitempty"`
+	Image            string              `yaml:"image,omitempty" toml:"image,omitempty"`
+	Digest           string              `yaml:"digest,omitempty" toml:"digest,omitempty"`
+	Tag              string              `yaml:"tag,omitempty" toml:"tag,omitempty"`
+	Server           net.IP              `yaml:"server,omitempty" toml:"server,omitempty"`
+	Username         string              `yaml:"username,omitempty" toml:"username,omitempty"`
+	RootDir          string              `yaml:"rootDir,omitempty" toml:"rootDir,omitempty"`
+	PrivateKey       RSAPrivateKey       `yaml:"privateKey,omitempty" toml:"privateKey,omitempty"`
+	Channel          string              `yaml:"channel,omitempty" toml:"channel,omitempty"`
+	EnvVars          []string            `yaml:"envVars,omitempty" toml:"envVars,omitempty"`
+	EnvFiles         []string            `yaml:"envFiles,omitempty" toml:"envFiles,omitempty"`
+	EnvValues        map[string]string   `yaml:"envValues,omitempty" toml:"envValues,omitempty"`
+	SecretVars       []string            `yaml:"secretVars,omitempty" toml:"secretVars,omitempty"`
+	ComposeFiles     []string            `yaml:"composeFiles,omitempty" toml:"composeFiles,omitempty"`
+	Files            []FileInclude       `yaml:"files,omitempty" toml:"files,omitempty"`
+	Hooks            map[string][]Hook   `yaml:"hooks,omitempty" toml:"hooks,omitempty"`
+	Sync             string              `yaml:"sync,omitempty" toml:"sync,omitempty"`
+	LockTimeout      string              `yaml:"lockTimeout,omitempty" toml:"lockTimeout,omitempty"`
+	HistoryRetention int                 `yaml:"historyRetention,omitempty" toml:"historyRetention,omitempty"`
+	Template         bool                `yaml:"template,omitempty" toml:"template,omitempty"`
+	Debug            bool                `yaml:"debug,omitempty" toml:"debug,omitempty"`
+	Channels         map[string]*Options `yaml:"channels,omitempty" toml:"channels,omitempty"`
+	Config           string              `json:"-" yaml:"-" toml:"-"`
+	AgeKey           string              `json:"-" yaml:"-" toml:"-"`
+
+	// explicitlySet contains the names of the options which were explicitly set by their source, see SetExplicitly.
+	explicitlySet map[string]bool
+}
+
+// SetExplicitly marks the specified option as explicitly set, so that its value is kept when merging even if it is false or empty.
+// Only the options named by RegistryLogoutOption, EnvVarsOption, EnvFilesOption, SecretVarsOption, ComposeFilesOption, HistoryRetentionOption, TemplateOption, and DebugOption are tracked.
+func (o *Options) SetExplicitly(name string) {
+	if o.explicitlySet == nil {
+		o.explicitlySet = make(map[string]bool)
+	}
+
+	o.explicitlySet[name] = true
+}
+
+// IsExplicitlySet checks whether the specified option was explicitly set, see SetExplicitly.
+func (o *Options) IsExplicitlySet(name string) bool {
+	return o.explicitlySet[name]
 }
 
 // Merge merges the other options into the existing options
 // When both fields are populated, the field from the existing options is kept.
+// Boolean and list fields which were explicitly set in the existing options are kept even if they are false or empty.
 func (o *Options) Merge(other *Options) {
 	if o.Registry == "" {
 		o.Registry = other.Registry
 	}
 
+	if o.RegistryUsername == "" {
+		o.RegistryUsername = other.RegistryUsername
+	}
+
+	if o.RegistryPassword == "" {
+		o.RegistryPassword = other.RegistryPassword
+	}
+
+	if !o.RegistryLogout && !o.IsExplicitlySet(RegistryLogoutOption) {
+		o.RegistryLogout = other.RegistryLogout
+		o.inheritExplicitlySet(other, RegistryLogoutOption)
+	}
+
 	if o.Image == "" {
 		o.Image = other.Image
 	}
@@ -46,6 +128,10 @@ func (o *Options) Merge(other *Options) {
 		o.Digest = other.Digest
 	}
 
+	if o.Tag == "" {
+		o.Tag = other.Tag
+	}
+
 	if o.Server == nil {
 		o.Server = other.Server
 	}
@@ -66,38 +152,157 @@ func (o *Options) Merge(other *Options) {
 		o.Channel = other.Channel
 	}
 
-	if len(o.EnvVars) == 0 {
+	if len(o.EnvVars) == 0 && !o.IsExplicitlySet(EnvVarsOption) {
 		o.EnvVars = other.EnvVars
+		o.inheritExplicitlySet(other, EnvVarsOption)
+	}
+
+	if len(o.EnvFiles) == 0 && !o.IsExplicitlySet(EnvFilesOption) {
+		o.EnvFiles = other.EnvFiles
+		o.inheritExplicitlySet(other, EnvFilesOption)
+	}
+
+	if len(o.EnvValues) == 0 {
+		o.EnvValues = other.EnvValues
+	}
+
+	if len(o.SecretVars) == 0 && !o.IsExplicitlySet(SecretVarsOption) {
+		o.SecretVars = other.SecretVars
+		o.inheritExplicitlySet(other, SecretVarsOption)
+	}
+
+	if len(o.ComposeFiles) == 0 && !o.IsExplicitlySet(ComposeFilesOption) {
+		o.ComposeFiles = other.ComposeFiles
+		o.inheritExplicitlySet(other, ComposeFilesOption)
+	}
+
+	if len(o.Files) == 0 {
+		o.Files = other.Files
+	}
+
+	if len(o.Hooks) == 0 {
+		o.Hooks = other.Hooks
+	}
+
+	if o.LockTimeout == "" {
+		o.LockTimeout = other.LockTimeout
+	}
+
+	if o.HistoryRetention == 0 && !o.IsExplicitlySet(HistoryRetentionOption) {
+		o.HistoryRetention = other.HistoryRetention
+		o.inheritExplicitlySet(other, HistoryRetentionOption)
+	}
+
+	if o.Sync == "" {
+		o.Sync = other.Sync
 	}
 
-	if !o.Debug {
+	if !o.Template && !o.IsExplicitlySet(TemplateOption) {
+		o.Template = other.Template
+		o.inheritExplicitlySet(other, TemplateOption)
+	}
+
+	if !o.Debug && !o.IsExplicitlySet(DebugOption) {
 		o.Debug = other.Debug
+		o.inheritExplicitlySet(other, DebugOption)
+	}
+
+	if len(o.Channels) == 0 {
+		o.Channels = other.Channels
+	}
+
+	if o.Config == "" {
+		o.Config = other.Config
+	}
+
+	if o.AgeKey == "" {
+		o.AgeKey = other.AgeKey
+	}
+}
+
+// GetChannelOptions gets the options with the profile for the specified channel from the Channels field layered on top.
+// Fields set in the channel profile take precedence over the fields of the options themselves.
+// If there is no profile for the channel, a copy of the options is returned.
+func (o *Options) GetChannelOptions(channel string) *Options {
+	channelOptions := &Options{}
+
+	if profile, ok := o.Channels[channel]; ok && profile != nil {
+		channelOptions = profile.Clone()
+	}
+
+	channelOptions.Merge(o)
+
+	return channelOptions
+}
+
+// GetDefaultOptions gets the default option values.
+func GetDefaultOptions() *Options {
+	return &Options{
+		Channel:     DefaultChannel,
+		RootDir:     "/",
+		Sync:        SyncModeAll,
+		LockTimeout: DefaultLockTimeout,
+		Debug:       false,
 	}
 }
 
 // MergeDefaults merges default option values into the given options.
 func (o *Options) MergeDefaults() {
-	defaults := Options{
-		Channel: "beta",
-		RootDir: "/",
-		Debug:   false,
+	o.Merge(GetDefaultOptions())
+}
+
+// Clone creates a copy of the options which can be merged into without affecting the original options.
+// Channel profiles are shared with the original options.
+func (o *Options) Clone() *Options {
+	clone := *o
+	clone.explicitlySet = nil
+
+	for name := range o.explicitlySet {
+		clone.SetExplicitly(name)
 	}
 
-	o.Merge(&defaults)
+	return &clone
 }
 
 // Verify verifies that the options are valid.
-// Returns an error with information about why the options are invalid.
+// The registry, image, digest, and tag are validated against the Docker image reference grammar.
+// Returns a *ValidationError with information about why the options are invalid, with the invalid fields sorted by name.
 func (o *Options) Verify() error {
 	errorMap := make(map[string]string)
 	empty := "<empty>"
 
+	if o.RegistryUsername != "" && o.RegistryPassword == "" {
+		errorMap["registry password"] = fmt.Sprintf("is %s but registry username is set", empty)
+	}
+
+	if o.RegistryUsername == "" && o.RegistryPassword != "" {
+		errorMap["registry username"] = fmt.Sprintf("is %s but registry password is set", empty)
+	}
+
+	if o.Registry != "" {
+		if err := ValidateRegistryHost(o.Registry); err != nil {
+			errorMap["registry"] = err.Error()
+		}
+	}
+
 	if o.Image == "" {
 		errorMap["image"] = fmt.Sprintf("is %s", empty)
+	} else if err := ValidateImageName(o.Image); err != nil {
+		errorMap["image"] = err.Error()
 	}
 
-	if o.Digest == "" {
-		errorMap["digest"] = fmt.Sprintf("is %s", empty)
+	if o.Digest == "" && o.Tag == "" {
+		errorMap["digest"] = fmt.Sprintf("is %s and no tag to resolve it from was provided", empty)
+	} else if o.Digest != "" {
+		if err := ValidateDigest(o.Digest); err != nil {
+			errorMap["digest"] = err.Error()
+		}
+	}
+
+	if o.Tag != "" {
+		if err := ValidateTag(o.Tag); err != nil {
+			errorMap["tag"] = err.Error()
+		}
 	}
 
 	if o.Server == nil {
@@ -120,110 +325,289 @@ func (o *Options) Verify() error {
 		errorMap["channel"] = fmt.Sprintf("is %s", empty)
 	}
 
-	if len(errorMap) != 0 {
-		errorString := "invalid options! "
+	for _, declaration := range o.EnvVars {
+		if _, err := ParseEnvVarDeclaration(declaration); err != nil {
+			errorMap["environment variables"] = err.Error()
+			break
+		}
+	}
 
-		for field, message := range errorMap {
-			errorString += fmt.Sprintf("%s %s, ", field, message)
+	for _, name := range o.SecretVars {
+		if !dotEnvNameRegexp.MatchString(name) {
+			errorMap["secret variables"] = fmt.Sprintf("\"%s\" is not a valid variable name", name)
+			break
 		}
+	}
 
-		errorString = errorString[:len(errorString)-2]
+	for _, include := range o.Files {
+		if err := include.Verify(); err != nil {
+			errorMap["files"] = fmt.Sprintf("include %s is invalid: %s", include, err)
+			break
+		}
+	}
 
-		return fmt.Errorf(errorString)
+	if err := verifyHooks(o.Hooks); err != nil {
+		errorMap["hooks"] = err.Error()
 	}
 
-	return nil
-}
+	if o.LockTimeout != "" {
+		if _, err := ParseLockTimeout(o.LockTimeout); err != nil {
+			errorMap["lock timeout"] = err.Error()
+		}
+	}
 
-// FromStrings converts strings into options.
-func (o *Options) FromStrings(registry string, image string, digest string, server string, username string, rootDir string, privateKey string, channel string, envVars string, debug string) error {
-	o.Registry = registry
+	if o.HistoryRetention < 0 {
+		errorMap["history retention"] = fmt.Sprintf("%d is negative", o.HistoryRetention)
+	}
 
-	o.Image = image
+	if o.Sync != "" && !isSyncMode(o.Sync) {
+		errorMap["sync"] = fmt.Sprintf("\"%s\" should be one of %s", o.Sync, strings.Join(SyncModes, ", "))
+	}
 
-	o.Digest = digest
+	channelNames := make([]string, 0, len(o.Channels))
 
-	if server != "" {
-		o.Server = net.ParseIP(server)
+	for name := range o.Channels {
+		channelNames = append(channelNames, name)
 	}
 
-	o.Username = username
-	o.RootDir = rootDir
+	sort.Strings(channelNames)
 
-	if privateKey != "" {
-		rsaPrivateKey := RSAPrivateKey{}
-		err := rsaPrivateKey.ParseBase64PEMString(privateKey)
-		if err != nil {
-			return err
+	for _, name := range channelNames {
+		profile := o.Channels[name]
+
+		if profile == nil {
+			continue
+		}
+
+		if profile.Channel != "" && profile.Channel != name {
+			errorMap["channels"] = fmt.Sprintf("profile %s sets a different channel %s", name, profile.Channel)
+			break
+		}
+
+		if len(profile.Channels) != 0 {
+			errorMap["channels"] = fmt.Sprintf("profile %s contains nested channel profiles", name)
+			break
 		}
-		o.PrivateKey = rsaPrivateKey
 	}
 
-	o.Channel = channel
+	validationError := newValidationError(errorMap)
 
-	if envVars != "" {
-		envVarsArr := strings.Split(envVars, ",")
-		o.EnvVars = envVarsArr
+	if validationError != nil {
+		return validationError
 	}
 
-	if debug != "" {
-		debugBool, err := strconv.ParseBool(debug)
-		if err != nil {
-			return err
+	return nil
+}
+
+// FromStrings converts strings into options.
+// The registry password is not included since it should only be read from the environment.
+// Empty values are ignored, and no options are marked as explicitly set, see FromStringValues to parse options by name.
+func (o *Options) FromStrings(registry string, registryUsername string, registryLogout string, image string, digest string, tag string, server string, username string, rootDir string, privateKey string, channel string, envVars string, envFiles string, secretVars string, composeFiles string, sync string, lockTimeout string, historyRetention string, template string, debug string) error {
+	values := map[string]string{
+		"registry":         registry,
+		"registryUsername": registryUsername,
+		"registryLogout":   registryLogout,
+		"image":            image,
+		"digest":           digest,
+		"tag":              tag,
+		"server":           server,
+		"username":         username,
+		"rootDir":          rootDir,
+		"privateKey":       privateKey,
+		"channel":          channel,
+		"envVars":          envVars,
+		"envFiles":         envFiles,
+		"secretVars":       secretVars,
+		"composeFiles":     composeFiles,
+		"sync":             sync,
+		"lockTimeout":      lockTimeout,
+		"historyRetention": historyRetention,
+		"template":         template,
+		"debug":            debug,
+	}
+
+	for key, value := range values {
+		if value == "" {
+			delete(values, key)
+		}
+	}
+
+	return o.fromStringValues(values, false)
+}
+
+// FromStringValues converts strings keyed by option name into options.
+// The option name is the config file key of the option such as "rootDir", or "registryPassword", "ageKey", and "config" for the options which can't be set in the config file.
+// Options which are missing from the values are left untouched, and empty values are ignored except for list options.
+// Boolean and list options which are present in the values are marked as explicitly set, see SetExplicitly, unless they are empty booleans.
+// Returns an error if any of the names is not an option or any of the values is invalid.
+// The values of secret options are never included in the error.
+func (o *Options) FromStringValues(values map[string]string) error {
+	return o.fromStringValues(values, true)
+}
+
+func (o *Options) fromStringValues(values map[string]string, setExplicitly bool) error {
+	for key := range values {
+		if _, ok := getOptionDefinition(key); !ok {
+			return fmt.Errorf("unknown option %s", key)
+		}
+	}
+
+	for _, definition := range optionDefinitions {
+		value, ok := values[definition.key]
+
+		if !ok || definition.fromString == nil {
+			continue
+		}
+
+		if err := definition.fromString(o, value); err != nil {
+			if definition.secret {
+				return fmt.Errorf("invalid %s: %s", definition.name, err)
+			}
+
+			return fmt.Errorf("invalid %s \"%s\": %s", definition.name, value, err)
 		}
 
-		o.Debug = debugBool
+		if setExplicitly && (value != "" || definition.list) {
+			o.setExplicitlyByKey(definition.key)
+		}
 	}
 
 	return nil
 }
 
+// FromFile parses options from a configuration file.
+// The format of the file is determined by its extension, see ConfigFileNames.
+// Files with any other extension are parsed as JSON.
+func (o *Options) FromFile(path string) error {
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		return o.FromYAML(path)
+	case ".toml":
+		return o.FromTOML(path)
+	default:
+		return o.FromJSON(path)
+	}
+}
+
 // FromJSON parses options from a JSON file.
 func (o *Options) FromJSON(path string) error {
-	file, err := ioutil.ReadFile(path)
+	file, err := readConfigFile(path)
+
+	if err != nil || file == nil {
+		return err
+	}
+
+	return json.Unmarshal(file, o)
+}
+
+// UnmarshalJSON unmarshals JSON into options.
+// Boolean and list options which are present in the JSON are marked as explicitly set, see SetExplicitly.
+func (o *Options) UnmarshalJSON(data []byte) error {
+	type options Options
+
+	err := json.Unmarshal(data, (*options)(o))
 
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+		return err
+	}
+
+	var keys map[string]json.RawMessage
+
+	err = json.Unmarshal(data, &keys)
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range keys {
+		if string(value) != "null" {
+			o.setExplicitlyByKey(key)
 		}
+	}
 
+	return nil
+}
+
+// UnmarshalYAML unmarshals YAML into options.
+// Boolean and list options which are present in the YAML are marked as explicitly set, see SetExplicitly.
+func (o *Options) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type options Options
+
+	err := unmarshal((*options)(o))
+
+	if err != nil {
 		return err
 	}
 
-	if len(file) == 0 {
-		return nil
+	var keys map[string]interface{}
+
+	err = unmarshal(&keys)
+
+	if err != nil {
+		return err
 	}
 
-	return json.Unmarshal(file, o)
+	for key, value := range keys {
+		if value != nil {
+			o.setExplicitlyByKey(key)
+		}
+	}
+
+	return nil
 }
 
-// FromEnv parses options from environment variables.
-// All variables should be prefixed and they should correspond to the available options with underscores separating words such as "PRIVATE_KEY".
-// The private key should be a base64 encoded string.
-// The environment variables should be a comma-separated string.
-func (o *Options) FromEnv() error {
-	prefix := OptionEnvVarPrefix
+// FromYAML parses options from a YAML file.
+// The keys are the same as for JSON files.
+func (o *Options) FromYAML(path string) error {
+	file, err := readConfigFile(path)
 
-	registry := os.Getenv(prefix + "REGISTRY")
-	image := os.Getenv(prefix + "IMAGE")
-	digest := os.Getenv(prefix + "DIGEST")
-	server := os.Getenv(prefix + "SERVER")
-	username := os.Getenv(prefix + "USERNAME")
-	rootDir := os.Getenv(prefix + "ROOT_DIR")
-	privateKey := os.Getenv(prefix + "PRIVATE_KEY")
-	channel := os.Getenv(prefix + "CHANNEL")
-	envVars := os.Getenv(prefix + "ENV_VARS")
-	debug := os.Getenv(prefix + "DEBUG")
+	if err != nil || file == nil {
+		return err
+	}
+
+	return yaml.Unmarshal(file, o)
+}
 
-	err := o.FromStrings(registry, image, digest, server, username, rootDir, privateKey, channel, envVars, debug)
+// FromTOML parses options from a TOML file.
+// The keys are the same as for JSON files.
+// Boolean and list options which are defined in the file are marked as explicitly set, see SetExplicitly.
+func (o *Options) FromTOML(path string) error {
+	file, err := readConfigFile(path)
+
+	if err != nil || file == nil {
+		return err
+	}
+
+	metaData, err := toml.Decode(string(file), o)
 
 	if err != nil {
 		return err
 	}
 
+	for _, name := range explicitOptionNames {
+		if metaData.IsDefined(name) {
+			o.SetExplicitly(name)
+		}
+
+		for channel, profile := range o.Channels {
+			if profile != nil && metaData.IsDefined("channels", channel, name) {
+				profile.SetExplicitly(name)
+			}
+		}
+	}
+
 	return nil
 }
 
+// FromEnv parses options from environment variables.
+// All variables should be prefixed and they should correspond to the available options with underscores separating words such as "PRIVATE_KEY", see OptionSources.
+// The values are parsed with FromStringValues, so the private key should be a base64 encoded string and lists should be comma-separated strings.
+// The registry password and the age key can only be provided from the environment.
+// Boolean options which are set and non-empty, and list options which are set even if empty, are marked as explicitly set, see SetExplicitly.
+func (o *Options) FromEnv() error {
+	return o.FromStringValues(getEnvOptionValues())
+}
+
 // GetDeploymentName gets the full name of the deployment.
 // The name is based on the image and the channel.
 // All non-alphanumeric characters are replaced by dashes.
@@ -238,8 +622,31 @@ func (o *Options) GetDeploymentName() (string, error) {
 	return deploymentName, nil
 }
 
+// ResolveDigest resolves the tag into the digest using the registry HTTP API V2 with the provided HTTP client.
+// If no tag is set, the options are left untouched.
+// If both a digest and a tag are set, the tag must resolve to the same digest.
+func (o *Options) ResolveDigest(client *http.Client) error {
+	if o.Tag == "" {
+		return nil
+	}
+
+	digest, err := ResolveTagDigest(client, o)
+
+	if err != nil {
+		return fmt.Errorf("error resolving tag %s to a digest: %s", o.Tag, err)
+	}
+
+	if o.Digest != "" && o.Digest != digest {
+		return fmt.Errorf("tag %s resolved to digest %s which does not match the provided digest %s", o.Tag, digest, o.Digest)
+	}
+
+	o.Digest = digest
+
+	return nil
+}
+
 // GetImageSpecifier gets the full image specifier for the deployment.
-// The specifier is based on the image and the digest.
+// The specifier is based on the image and the digest, since only the digest guarantees immutability.
 func (o *Options) GetImageSpecifier() string {
 	separator := ""
 
@@ -252,25 +659,139 @@ func (o *Options) GetImageSpecifier() string {
 	return specifier
 }
 
-// GetDeploymentEnvValues gets the values of the environment variables specified in the EnvVars field to be injected into the deployment.
-// Returns a map of the variable names to values, or an error if any of the variables are blank or unset.
+// EnvVarDeclaration describes a deployment environment variable declared in the EnvVars field.
+// Declarations are of the form "NAME" for required variables, "NAME?" for variables which are allowed to be empty, and "NAME=default" for variables with a default value.
+type EnvVarDeclaration struct {
+	Name       string
+	Default    string
+	HasDefault bool
+	AllowEmpty bool
+}
+
+// ParseEnvVarDeclaration parses a deployment environment variable declaration, see EnvVarDeclaration.
+func ParseEnvVarDeclaration(declaration string) (EnvVarDeclaration, error) {
+	parsed := EnvVarDeclaration{
+		Name: declaration,
+	}
+
+	if separatorIndex := strings.Index(declaration, "="); separatorIndex != -1 {
+		parsed.Name = declaration[:separatorIndex]
+		parsed.Default = declaration[separatorIndex+1:]
+		parsed.HasDefault = true
+	} else if strings.HasSuffix(declaration, "?") {
+		parsed.Name = strings.TrimSuffix(declaration, "?")
+		parsed.AllowEmpty = true
+	}
+
+	if !dotEnvNameRegexp.MatchString(parsed.Name) {
+		return EnvVarDeclaration{}, fmt.Errorf("invalid environment variable declaration \"%s\"", declaration)
+	}
+
+	return parsed, nil
+}
+
+// GetDeploymentEnvValues gets the values of the environment variables to be injected into the deployment.
+// All of the variables from the EnvValues field and the files in the EnvFiles field are included, and each of the variables declared in the EnvVars field must resolve to a value.
+// The sources in order of precedence are: the prefixed variable in the environment (only for declared variables), the dotenv files (later files take precedence), the EnvValues field, the default value from the declaration.
+// Blank environment variables are treated as unset.
+// Returns a map of the variable names to values, or an error if any of the declared variables are blank or unset and not allowed to be empty.
 func (o *Options) GetDeploymentEnvValues() (map[string]string, error) {
+	return o.GetDeploymentEnvValuesWithSecrets(nil)
+}
+
+// GetDeploymentEnvValuesWithSecrets gets the values of the environment variables to be injected into the deployment like GetDeploymentEnvValues, including the provided decrypted secrets.
+// The secrets take precedence over the dotenv files, but not over the prefixed variables in the environment.
+func (o *Options) GetDeploymentEnvValuesWithSecrets(secrets map[string]string) (map[string]string, error) {
 	m := make(map[string]string)
 
-	for _, variableName := range o.EnvVars {
-		variableNameWithPrefix := DeploymentEnvVarPrefix + variableName
-		value := os.Getenv(variableNameWithPrefix)
+	for variableName, value := range o.EnvValues {
+		m[variableName] = value
+	}
+
+	for _, path := range o.EnvFiles {
+		fileVariables, err := ParseDotEnvFile(path)
 
-		if value == "" {
-			return nil, fmt.Errorf("environment variable %s is blank or unset", variableNameWithPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("error reading environment file: %s", err)
 		}
 
+		for variableName, value := range fileVariables {
+			m[variableName] = value
+		}
+	}
+
+	for variableName, value := range secrets {
 		m[variableName] = value
 	}
 
+	for _, declaration := range o.EnvVars {
+		parsed, err := ParseEnvVarDeclaration(declaration)
+
+		if err != nil {
+			return nil, err
+		}
+
+		variableNameWithPrefix := DeploymentEnvVarPrefix + parsed.Name
+
+		if value := os.Getenv(variableNameWithPrefix); value != "" {
+			m[parsed.Name] = value
+			continue
+		}
+
+		if m[parsed.Name] != "" {
+			continue
+		}
+
+		if parsed.HasDefault {
+			m[parsed.Name] = parsed.Default
+			continue
+		}
+
+		if parsed.AllowEmpty {
+			m[parsed.Name] = ""
+			continue
+		}
+
+		return nil, fmt.Errorf("environment variable %s is blank or unset, and %s is not set by any secret, environment file, or value", variableNameWithPrefix, parsed.Name)
+	}
+
 	return m, nil
 }
 
+func (o *Options) inheritExplicitlySet(other *Options, name string) {
+	if other.IsExplicitlySet(name) {
+		o.SetExplicitly(name)
+	}
+}
+
+func (o *Options) setExplicitlyByKey(key string) {
+	for _, name := range explicitOptionNames {
+		if strings.EqualFold(key, name) {
+			o.SetExplicitly(name)
+		}
+	}
+}
+
+// readConfigFile reads a configuration file.
+// Returns nil if the file doesn't exist or is empty, since that is equivalent to not providing any options.
+func readConfigFile(path string) ([]byte, error) {
+	file, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if len(file) == 0 {
+		return nil, nil
+	}
+
+	return file, nil
+}
+
 func replaceNonAlphanumeric(input string, replaceWith string) (string, error) {
 	regStr := "[^a-zA-Z0-9]+"
 	reg, err := regexp.Compile(regStr)
@@ -1,13 +1,18 @@
 package sad_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+
 	testutils "github.com/jswny/sad/internal"
 
 	"github.com/jswny/sad"
@@ -64,6 +69,51 @@ func TestOptionsMergeSomeEmptyValues(t *testing.T) {
 	testutils.CompareOpts(expectedOpts, optsToMergeInto, t)
 }
 
+func TestOptionsMergeExplicitZeroValues(t *testing.T) {
+	optsToMerge := testutils.GetTestOpts()
+	optsToMergeInto := sad.Options{}
+
+	optsToMergeInto.SetExplicitly(sad.RegistryLogoutOption)
+	optsToMergeInto.SetExplicitly(sad.EnvVarsOption)
+	optsToMergeInto.SetExplicitly(sad.DebugOption)
+
+	optsToMergeInto.Merge(&optsToMerge)
+
+	if optsToMergeInto.RegistryLogout {
+		t.Errorf("Expected explicit registry logout false to be kept but got true")
+	}
+
+	if len(optsToMergeInto.EnvVars) != 0 {
+		t.Errorf("Expected explicit empty environment variables to be kept but got %s", optsToMergeInto.EnvVars)
+	}
+
+	if optsToMergeInto.Debug {
+		t.Errorf("Expected explicit debug false to be kept but got true")
+	}
+}
+
+func TestOptionsMergeInheritsExplicitlySet(t *testing.T) {
+	lowest := sad.Options{
+		Debug: true,
+	}
+
+	middle := sad.Options{}
+	middle.SetExplicitly(sad.DebugOption)
+
+	highest := sad.Options{}
+
+	highest.Merge(&middle)
+	highest.Merge(&lowest)
+
+	if highest.Debug {
+		t.Errorf("Expected explicit debug false from the middle options to be kept but got true")
+	}
+
+	if !highest.IsExplicitlySet(sad.DebugOption) {
+		t.Errorf("Expected debug to be marked as explicitly set after merging")
+	}
+}
+
 func TestOptionsMergeDefaults(t *testing.T) {
 	expectedOpts := testutils.GetTestOpts()
 	opts := sad.Options{}
@@ -84,6 +134,78 @@ func TestOptionsMergeDefaults(t *testing.T) {
 	testutils.CompareOpts(expectedOpts, opts, t)
 }
 
+func TestOptionsGetChannelOptions(t *testing.T) {
+	data := []byte(`{
+		"server": "1.2.3.4",
+		"rootDir": "/srv",
+		"envVars": ["FOO"],
+		"channels": {
+			"prod": {
+				"server": "5.6.7.8",
+				"envVars": ["FOO", "BAR"]
+			}
+		}
+	}`)
+
+	tempFile, err := ioutil.TempFile(".", ".sad.json.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), data, 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromJSON(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	channelOpts := opts.GetChannelOptions("prod")
+
+	testutils.CompareStrings("server", "5.6.7.8", channelOpts.Server.String(), t)
+	testutils.CompareStrings("root directory", "/srv", channelOpts.RootDir, t)
+	testutils.CompareStrings("environment variables", "FOO,BAR", strings.Join(channelOpts.EnvVars, ","), t)
+
+	testutils.CompareStrings("original server", "1.2.3.4", opts.Server.String(), t)
+}
+
+func TestOptionsGetChannelOptionsNoProfile(t *testing.T) {
+	expectedOpts := testutils.GetTestOpts()
+	expectedOpts.Channels = map[string]*sad.Options{
+		"prod": {
+			RootDir: "/prod",
+		},
+	}
+
+	channelOpts := expectedOpts.GetChannelOptions("beta")
+
+	testutils.CompareOpts(expectedOpts, *channelOpts, t)
+}
+
+func TestOptionsVerifyChannelProfileDifferentChannel(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Channels = map[string]*sad.Options{
+		"prod": {
+			Channel: "beta",
+		},
+	}
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "channels profile prod sets a different channel beta") {
+		t.Errorf("Error message doesn't contain channels error: %s", err)
+	}
+}
+
 func TestOptionsVerifyValid(t *testing.T) {
 	opts := testutils.GetTestOpts()
 
@@ -109,31 +231,326 @@ func TestOptionsVerifyInvalid(t *testing.T) {
 	}
 }
 
+func TestOptionsVerifyInvalidDigest(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Digest = "latest"
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "digest \"latest\" is not of the form <algorithm>:<hex>") {
+		t.Errorf("Error message doesn't contain digest error: %s", err)
+	}
+}
+
+func TestOptionsVerifyInvalidSync(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Sync = "always"
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "sync \"always\" should be one of all, changed, mirror") {
+		t.Errorf("Error message doesn't contain sync error: %s", err)
+	}
+}
+
+func TestOptionsVerifyInvalidLockTimeout(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.LockTimeout = "5"
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "lock timeout \"5\" is not a valid duration") {
+		t.Errorf("Error message doesn't contain lock timeout error: %s", err)
+	}
+}
+
+func TestOptionsVerifyNegativeHistoryRetention(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.HistoryRetention = -1
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "history retention -1 is negative") {
+		t.Errorf("Error message doesn't contain history retention error: %s", err)
+	}
+}
+
+func TestOptionsVerifyInvalidHooks(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Hooks = map[string][]sad.Hook{
+		"pre-deploy": {{Command: "echo foo", Run: sad.HookRunLocal}},
+	}
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "hooks phase \"pre-deploy\" should be one of pre-upload, pre-start, post-start, on-failure") {
+		t.Errorf("Error message doesn't contain hooks error: %s", err)
+	}
+}
+
+func TestOptionsVerifyImageWithTag(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Image = "user/foo:latest"
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "contains a tag") {
+		t.Errorf("Error message doesn't contain image error: %s", err)
+	}
+}
+
+func TestOptionsVerifySortedErrors(t *testing.T) {
+	opts := sad.Options{
+		Registry: "https://ghcr.io",
+		Digest:   "latest",
+	}
+
+	expected := "invalid options! channel is <empty>, digest \"latest\" is not of the form <algorithm>:<hex>, image is <empty>, private key is nil, registry \"https://ghcr.io\" is not a valid registry host, root directory is <empty>, server is nil, username is <empty>"
+
+	for i := 0; i < 10; i++ {
+		err := opts.Verify()
+
+		if err == nil {
+			t.Fatalf("No error verifying options")
+		}
+
+		testutils.CompareStrings("error", expected, err.Error(), t)
+	}
+}
+
+func TestOptionsVerifyValidationError(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Image = ""
+	opts.RootDir = ""
+
+	err := opts.Verify()
+
+	var validationError *sad.ValidationError
+
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Expected validation error but got: %s", err)
+	}
+
+	expected := []sad.FieldError{
+		{
+			Field:   "image",
+			Source:  sad.OptionSource{Flag: "image", EnvVar: "SAD_IMAGE", ConfigKey: "image"},
+			Problem: "is <empty>",
+		},
+		{
+			Field:   "root directory",
+			Source:  sad.OptionSource{Flag: "root-dir", EnvVar: "SAD_ROOT_DIR", ConfigKey: "rootDir"},
+			Problem: "is <empty>",
+		},
+	}
+
+	if len(validationError.Errors) != len(expected) {
+		t.Fatalf("Expected %d field errors but got %d: %s", len(expected), len(validationError.Errors), err)
+	}
+
+	for i, fieldError := range validationError.Errors {
+		testutils.CompareStrings("field", expected[i].Field, fieldError.Field, t)
+		if fieldError.Source != expected[i].Source {
+			t.Errorf("Expected source %+v but got %+v", expected[i].Source, fieldError.Source)
+		}
+
+		testutils.CompareStrings("source description", expected[i].Source.String(), fieldError.Source.String(), t)
+		testutils.CompareStrings("problem", expected[i].Problem, fieldError.Problem, t)
+	}
+}
+
+func TestValidationErrorWithout(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Digest = ""
+	opts.Tag = ""
+
+	err := opts.Verify()
+
+	var validationError *sad.ValidationError
+
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Expected validation error but got: %s", err)
+	}
+
+	if err := validationError.Without("digest"); err != nil {
+		t.Errorf("Expected no error without the digest but got: %s", err)
+	}
+
+	opts.RootDir = ""
+
+	err = opts.Verify()
+
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Expected validation error but got: %s", err)
+	}
+
+	err = validationError.Without("digest")
+
+	if err == nil {
+		t.Fatalf("Expected error without the digest but got nil")
+	}
+
+	testutils.CompareStrings("error", "invalid options! root directory is <empty>", err.Error(), t)
+}
+
+func TestOptionsVerifyRegistryPasswordSource(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.RegistryPassword = ""
+
+	err := opts.Verify()
+
+	var validationError *sad.ValidationError
+
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Expected validation error but got: %s", err)
+	}
+
+	testutils.CompareStrings("source", "SAD_REGISTRY_PASSWORD environment variable", validationError.Errors[0].Source.String(), t)
+}
+
+func TestOptionsVerifyRegistryUsernameWithoutPassword(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.RegistryPassword = ""
+
+	err := opts.Verify()
+
+	if err == nil {
+		t.Fatalf("No error verifying options")
+	}
+
+	if !strings.Contains(err.Error(), "registry password") {
+		t.Errorf("Error message doesn't contain registry password error: %s", err)
+	}
+}
+
 func TestOptionsFromStrings(t *testing.T) {
 	testOpts := testutils.GetTestOpts()
 	stringTestOpts := testutils.StringOptions{}
 	stringTestOpts.FromOptions(&testOpts)
 
 	registry := stringTestOpts.Registry
+	registryUsername := stringTestOpts.RegistryUsername
+	registryLogout := stringTestOpts.RegistryLogout
 	image := stringTestOpts.Image
 	digest := stringTestOpts.Digest
+	tag := stringTestOpts.Tag
 	server := stringTestOpts.Server
 	username := stringTestOpts.Username
 	rootDir := stringTestOpts.RootDir
 	privateKey := stringTestOpts.PrivateKey
 	channel := stringTestOpts.Channel
 	envVars := stringTestOpts.EnvVars
+	envFiles := stringTestOpts.EnvFiles
+	secretVars := stringTestOpts.SecretVars
+	composeFiles := stringTestOpts.ComposeFiles
+	sync := stringTestOpts.Sync
+	lockTimeout := stringTestOpts.LockTimeout
+	historyRetention := stringTestOpts.HistoryRetention
+	template := stringTestOpts.Template
 	debug := stringTestOpts.Debug
 
 	opts := sad.Options{}
-	err := opts.FromStrings(registry, image, digest, server, username, rootDir, privateKey, channel, envVars, debug)
+	err := opts.FromStrings(registry, registryUsername, registryLogout, image, digest, tag, server, username, rootDir, privateKey, channel, envVars, envFiles, secretVars, composeFiles, sync, lockTimeout, historyRetention, template, debug)
 	if err != nil {
 		t.Fatalf("Error getting options from test options strings: %s", err)
 	}
 
+	testOpts.RegistryPassword = ""
+
 	testutils.CompareOpts(testOpts, opts, t)
 }
 
+func TestOptionsFromStringValues(t *testing.T) {
+	testOpts := testutils.GetTestOpts()
+
+	stringTestOpts := testutils.StringOptions{}
+	stringTestOpts.FromOptions(&testOpts)
+
+	opts := sad.Options{}
+	err := opts.FromStringValues(stringTestOpts.Values())
+	if err != nil {
+		t.Fatalf("Error getting options from test options strings: %s", err)
+	}
+
+	testutils.CompareOpts(testOpts, opts, t)
+
+	for _, name := range []string{sad.RegistryLogoutOption, sad.EnvVarsOption, sad.HistoryRetentionOption, sad.DebugOption} {
+		if !opts.IsExplicitlySet(name) {
+			t.Errorf("Expected %s to be explicitly set", name)
+		}
+	}
+}
+
+func TestOptionsFromStringValuesUnknownOption(t *testing.T) {
+	opts := sad.Options{}
+	err := opts.FromStringValues(map[string]string{"root-dir": "/srv"})
+
+	if err == nil {
+		t.Fatalf("Expected error for unknown option but got nil")
+	}
+
+	testutils.CompareStrings("error", "unknown option root-dir", err.Error(), t)
+}
+
+func TestOptionsFromStringValuesInvalidValue(t *testing.T) {
+	opts := sad.Options{}
+	err := opts.FromStringValues(map[string]string{sad.HistoryRetentionOption: "ten"})
+
+	if err == nil {
+		t.Fatalf("Expected error for invalid value but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "invalid history retention \"ten\"") {
+		t.Errorf("Expected error to name the invalid option but got: %s", err)
+	}
+}
+
+func TestOptionsFromEnvInvalidSecretValue(t *testing.T) {
+	secret := "TOPSECRET-not-base64!!"
+
+	os.Setenv(sad.OptionEnvVarPrefix+"PRIVATE_KEY", secret)
+	defer os.Unsetenv(sad.OptionEnvVarPrefix + "PRIVATE_KEY")
+
+	opts := sad.Options{}
+	err := opts.FromEnv()
+
+	if err == nil {
+		t.Fatalf("Expected error for invalid private key but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "private key") {
+		t.Errorf("Expected error to name the private key but got: %s", err)
+	}
+
+	if strings.Contains(err.Error(), secret) {
+		t.Errorf("Expected error not to contain the private key but got: %s", err)
+	}
+}
+
 func TestOptionsFromJSON(t *testing.T) {
 	testOpts := testutils.GetTestOpts()
 	testOptsData, err := json.Marshal(testOpts)
@@ -160,9 +577,250 @@ func TestOptionsFromJSON(t *testing.T) {
 		t.Fatalf("Error getting options from file: %s", err)
 	}
 
+	testOpts.RegistryPassword = ""
+
+	testutils.CompareOpts(testOpts, opts, t)
+}
+
+func TestOptionsFromJSONIgnoresRegistryPassword(t *testing.T) {
+	data := []byte(`{"registryUsername": "user", "registryPassword": "secret"}`)
+
+	tempFile, err := ioutil.TempFile(".", ".sad.json.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), data, 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromJSON(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	testutils.CompareStrings("registry username", "user", opts.RegistryUsername, t)
+	testutils.CompareStrings("registry password", "", opts.RegistryPassword, t)
+}
+
+func TestOptionsFromJSONExplicitZeroValues(t *testing.T) {
+	data := []byte(`{"debug": false, "envVars": [], "rootDir": "/srv"}`)
+
+	tempFile, err := ioutil.TempFile(".", ".sad.json.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), data, 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromJSON(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	if !opts.IsExplicitlySet(sad.DebugOption) {
+		t.Errorf("Expected debug to be explicitly set")
+	}
+
+	if !opts.IsExplicitlySet(sad.EnvVarsOption) {
+		t.Errorf("Expected environment variables to be explicitly set")
+	}
+
+	if opts.IsExplicitlySet(sad.RegistryLogoutOption) {
+		t.Errorf("Expected registry logout not to be explicitly set")
+	}
+}
+
+func TestOptionsFromYAMLExplicitZeroValues(t *testing.T) {
+	data := []byte("debug: false\nchannels:\n  prod:\n    envVars: []\n")
+
+	tempFile, err := ioutil.TempFile(".", ".sad.yml.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), data, 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromYAML(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	if !opts.IsExplicitlySet(sad.DebugOption) {
+		t.Errorf("Expected debug to be explicitly set")
+	}
+
+	if opts.IsExplicitlySet(sad.EnvVarsOption) {
+		t.Errorf("Expected environment variables not to be explicitly set")
+	}
+
+	if !opts.Channels["prod"].IsExplicitlySet(sad.EnvVarsOption) {
+		t.Errorf("Expected environment variables to be explicitly set in the channel profile")
+	}
+}
+
+func TestOptionsFromTOMLExplicitZeroValues(t *testing.T) {
+	data := []byte("debug = false\n\n[channels.prod]\nenvVars = []\n")
+
+	tempFile, err := ioutil.TempFile(".", ".sad.toml.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), data, 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromTOML(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	if !opts.IsExplicitlySet(sad.DebugOption) {
+		t.Errorf("Expected debug to be explicitly set")
+	}
+
+	if opts.IsExplicitlySet(sad.EnvVarsOption) {
+		t.Errorf("Expected environment variables not to be explicitly set")
+	}
+
+	if !opts.Channels["prod"].IsExplicitlySet(sad.EnvVarsOption) {
+		t.Errorf("Expected environment variables to be explicitly set in the channel profile")
+	}
+}
+
+func TestOptionsFromYAML(t *testing.T) {
+	testOpts := testutils.GetTestOpts()
+	testOptsData, err := yaml.Marshal(testOpts)
+
+	if err != nil {
+		t.Fatalf("Error marshaling test options: %s", err)
+	}
+
+	tempFile, err := ioutil.TempFile(".", ".sad.yml.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), testOptsData, 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromYAML(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	testOpts.RegistryPassword = ""
+
+	testutils.CompareOpts(testOpts, opts, t)
+}
+
+func TestOptionsFromTOML(t *testing.T) {
+	testOpts := testutils.GetTestOpts()
+
+	var buf bytes.Buffer
+
+	if err := toml.NewEncoder(&buf).Encode(testOpts); err != nil {
+		t.Fatalf("Error marshaling test options: %s", err)
+	}
+
+	tempFile, err := ioutil.TempFile(".", ".sad.toml.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(tempFile.Name())
+
+	if err := ioutil.WriteFile(tempFile.Name(), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{}
+
+	if err := opts.FromTOML(tempFile.Name()); err != nil {
+		t.Fatalf("Error getting options from file: %s", err)
+	}
+
+	testOpts.RegistryPassword = ""
+
 	testutils.CompareOpts(testOpts, opts, t)
 }
 
+func TestOptionsFromFile(t *testing.T) {
+	contents := map[string]string{
+		".json": `{"rootDir": "/srv", "envVars": ["FOO"], "files": [{"source": "conf/*", "target": "nginx", "permissions": "0600"}], "hooks": {"pre-start": [{"command": "migrate", "run": "remote", "service": "app"}]}, "channels": {"prod": {"rootDir": "/prod"}}}`,
+		".yml":  "rootDir: /srv\nenvVars:\n  - FOO\nfiles:\n  - source: conf/*\n    target: nginx\n    permissions: \"0600\"\nhooks:\n  pre-start:\n    - command: migrate\n      run: remote\n      service: app\nchannels:\n  prod:\n    rootDir: /prod\n",
+		".yaml": "rootDir: /srv\nenvVars: [FOO]\nfiles: [{source: conf/*, target: nginx, permissions: \"0600\"}]\nhooks: {pre-start: [{command: migrate, run: remote, service: app}]}\nchannels:\n  prod:\n    rootDir: /prod\n",
+		".toml": "rootDir = \"/srv\"\nenvVars = [\"FOO\"]\n\n[[files]]\nsource = \"conf/*\"\ntarget = \"nginx\"\npermissions = \"0600\"\n\n[[hooks.pre-start]]\ncommand = \"migrate\"\nrun = \"remote\"\nservice = \"app\"\n\n[channels.prod]\nrootDir = \"/prod\"\n",
+	}
+
+	for extension, content := range contents {
+		tempFile, err := ioutil.TempFile(".", ".sad.test.*"+extension)
+
+		if err != nil {
+			t.Fatalf("Error creating temp file: %s", err)
+		}
+
+		defer os.Remove(tempFile.Name())
+
+		if err := ioutil.WriteFile(tempFile.Name(), []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing to temp file: %s", err)
+		}
+
+		opts := sad.Options{}
+
+		if err := opts.FromFile(tempFile.Name()); err != nil {
+			t.Fatalf("Error getting options from %s file: %s", extension, err)
+		}
+
+		expectedOpts := sad.Options{
+			RootDir: "/srv",
+			EnvVars: []string{"FOO"},
+			Files: []sad.FileInclude{
+				{Source: "conf/*", Target: "nginx", Permissions: "0600"},
+			},
+			Hooks: map[string][]sad.Hook{
+				"pre-start": {
+					{Command: "migrate", Run: "remote", Service: "app"},
+				},
+			},
+			Channels: map[string]*sad.Options{
+				"prod": {
+					RootDir: "/prod",
+				},
+			},
+		}
+
+		testutils.CompareOpts(expectedOpts, opts, t)
+	}
+}
+
 func TestOptionsFromJSONEmptyValues(t *testing.T) {
 	testOpts := sad.Options{}
 	testOptsData, err := json.Marshal(testOpts)
@@ -210,6 +868,35 @@ func TestOptionsFromEnv(t *testing.T) {
 	testutils.CompareOpts(testOpts, opts, t)
 }
 
+func TestOptionsFromEnvExplicitZeroValues(t *testing.T) {
+	variables := map[string]string{
+		"DEBUG":    "false",
+		"ENV_VARS": "",
+	}
+
+	testutils.SetEnvVars(variables, sad.OptionEnvVarPrefix)
+	defer testutils.UnsetEnvVars([]string{"DEBUG", "ENV_VARS"}, sad.OptionEnvVarPrefix)
+
+	opts := sad.Options{}
+	err := opts.FromEnv()
+
+	if err != nil {
+		t.Fatalf("Error getting options from environment: %s", err)
+	}
+
+	if !opts.IsExplicitlySet(sad.DebugOption) {
+		t.Errorf("Expected debug to be explicitly set")
+	}
+
+	if !opts.IsExplicitlySet(sad.EnvVarsOption) {
+		t.Errorf("Expected environment variables to be explicitly set")
+	}
+
+	if opts.IsExplicitlySet(sad.RegistryLogoutOption) {
+		t.Errorf("Expected registry logout not to be explicitly set")
+	}
+}
+
 func TestOptionsFromEnvEmptyValues(t *testing.T) {
 	testOpts := sad.Options{}
 
@@ -328,3 +1015,128 @@ func TestGetEnvValuesBlank(t *testing.T) {
 		t.Errorf("Expected nil returned environment variables but got: %s", envMap)
 	}
 }
+
+func TestParseEnvVarDeclaration(t *testing.T) {
+	expected := map[string]sad.EnvVarDeclaration{
+		"FOO":      {Name: "FOO"},
+		"FOO?":     {Name: "FOO", AllowEmpty: true},
+		"FOO=bar":  {Name: "FOO", Default: "bar", HasDefault: true},
+		"FOO=":     {Name: "FOO", HasDefault: true},
+		"FOO=a=b?": {Name: "FOO", Default: "a=b?", HasDefault: true},
+	}
+
+	for declaration, expectedParsed := range expected {
+		parsed, err := sad.ParseEnvVarDeclaration(declaration)
+
+		if err != nil {
+			t.Errorf("Error parsing declaration %s: %s", declaration, err)
+			continue
+		}
+
+		if parsed != expectedParsed {
+			t.Errorf("Expected declaration %s to parse to %+v but got %+v", declaration, expectedParsed, parsed)
+		}
+	}
+
+	if _, err := sad.ParseEnvVarDeclaration("FOO BAR"); err == nil {
+		t.Errorf("Expected error parsing invalid declaration but got nil")
+	}
+}
+
+func TestGetDeploymentEnvValuesSources(t *testing.T) {
+	firstFile, err := ioutil.TempFile(".", ".env.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(firstFile.Name())
+
+	secondFile, err := ioutil.TempFile(".", ".env.test.")
+
+	if err != nil {
+		t.Fatalf("Error creating temp file: %s", err)
+	}
+
+	defer os.Remove(secondFile.Name())
+
+	if err := ioutil.WriteFile(firstFile.Name(), []byte("FILE=first\nOVERRIDDEN=first\nUNDECLARED=file\n"), 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	if err := ioutil.WriteFile(secondFile.Name(), []byte("OVERRIDDEN=second\n"), 0644); err != nil {
+		t.Fatalf("Error writing to temp file: %s", err)
+	}
+
+	opts := sad.Options{
+		EnvVars: []string{
+			"PROCESS",
+			"FILE",
+			"OVERRIDDEN",
+			"VALUE",
+			"DEFAULTED=default",
+			"OPTIONAL?",
+		},
+		EnvFiles: []string{
+			firstFile.Name(),
+			secondFile.Name(),
+		},
+		EnvValues: map[string]string{
+			"FILE":    "value",
+			"VALUE":   "value",
+			"PROCESS": "value",
+		},
+	}
+
+	prefix := sad.DeploymentEnvVarPrefix
+	testutils.SetEnvVars(map[string]string{"PROCESS": "process", "OPTIONAL": ""}, prefix)
+	defer testutils.UnsetEnvVars([]string{"PROCESS", "OPTIONAL"}, prefix)
+
+	envMap, err := opts.GetDeploymentEnvValues()
+
+	if err != nil {
+		t.Fatalf("Error getting deployment environment values: %s", err)
+	}
+
+	expected := map[string]string{
+		"PROCESS":    "process",
+		"FILE":       "first",
+		"OVERRIDDEN": "second",
+		"VALUE":      "value",
+		"DEFAULTED":  "default",
+		"OPTIONAL":   "",
+		"UNDECLARED": "file",
+	}
+
+	if len(envMap) != len(expected) {
+		t.Errorf("Expected %d variables but got %d: %s", len(expected), len(envMap), envMap)
+	}
+
+	for name, value := range expected {
+		actual, ok := envMap[name]
+
+		if !ok {
+			t.Errorf("Expected variable %s to be set", name)
+		}
+
+		testutils.CompareStrings("variable "+name, value, actual, t)
+	}
+}
+
+func TestGetDeploymentEnvValuesMissingFile(t *testing.T) {
+	opts := sad.Options{
+		EnvFiles: []string{
+			"missing.env",
+		},
+	}
+
+	_, err := opts.GetDeploymentEnvValues()
+
+	if err == nil {
+		t.Fatalf("Expected error getting deployment environment values but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "missing.env") {
+		t.Errorf("Expected error to contain the file name but got: %s", err)
+	}
+}
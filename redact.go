@@ -0,0 +1,211 @@
+package sad
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MinRedactedLength is the minimum length of a secret value to be redacted.
+// Shorter values such as "1" or "yes" would mask unrelated output, so they are ignored.
+var MinRedactedLength = 4
+
+// Redactor replaces every secret value it knows about with RedactedValue.
+// It is safe for concurrent use.
+type Redactor struct {
+	mutex   sync.RWMutex
+	secrets []string
+}
+
+// NewRedactor creates a redactor which knows about the provided secret values.
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(secrets...)
+
+	return r
+}
+
+// Add adds secret values to be redacted.
+// Multi-line values are also redacted line by line, since output is often split into lines.
+// Values shorter than MinRedactedLength are ignored.
+func (r *Redactor) Add(secrets ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, secret := range secrets {
+		r.addSecret(secret)
+
+		if strings.Contains(secret, "\n") {
+			for _, line := range strings.Split(secret, "\n") {
+				r.addSecret(strings.TrimSpace(line))
+			}
+		}
+	}
+
+	// Redact longer secrets first so that secrets containing other secrets are fully redacted.
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+// AddOptions adds the secret values of the options to be redacted, which are the registry password, the age key, and the private key.
+// The private key is added both as a base64 encoded PEM block and as the lines of the PEM block content.
+func (r *Redactor) AddOptions(opts *Options) {
+	r.Add(opts.RegistryPassword, opts.AgeKey)
+
+	if opts.PrivateKey.PrivateKey == nil {
+		return
+	}
+
+	encoded := opts.PrivateKey.ToBase64PEMString()
+	r.Add(encoded)
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return
+	}
+
+	for _, line := range strings.Split(string(decoded), "\n") {
+		if !strings.HasPrefix(line, "-----") {
+			r.Add(line)
+		}
+	}
+}
+
+// AddValues adds all of the values of a map of variable names to values to be redacted, such as the secret values returned by GetDeploymentEnv.
+func (r *Redactor) AddValues(values map[string]string) {
+	for _, value := range values {
+		r.Add(value)
+	}
+}
+
+// Secrets gets the secret values known by the redactor, longest first.
+func (r *Redactor) Secrets() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	secrets := make([]string, len(r.secrets))
+	copy(secrets, r.secrets)
+
+	return secrets
+}
+
+// Redact replaces every secret value in the string with RedactedValue.
+func (r *Redactor) Redact(s string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, RedactedValue)
+	}
+
+	return s
+}
+
+// Writer wraps a writer so that everything written to it is redacted first.
+// Secrets split across writes are redacted as well, such as in streamed output, by holding back the end of a write while it could be the start of a secret.
+// Close must be called when done writing to write any output which is still held back, which doesn't close the wrapped writer.
+func (r *Redactor) Writer(w io.Writer) io.WriteCloser {
+	return &redactingWriter{
+		redactor: r,
+		writer:   w,
+	}
+}
+
+// WriteGitHubMasks writes an "::add-mask::" workflow command for each secret value, which tells GitHub Actions to mask the value in the logs of the job.
+// Since GitHub Actions masks values line by line, only single-line values are written.
+func (r *Redactor) WriteGitHubMasks(w io.Writer) error {
+	for _, secret := range r.Secrets() {
+		if strings.Contains(secret, "\n") {
+			continue
+		}
+
+		_, err := fmt.Fprintf(w, "::add-mask::%s\n", secret)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Redactor) addSecret(secret string) {
+	if len(secret) < MinRedactedLength {
+		return
+	}
+
+	for _, existing := range r.secrets {
+		if existing == secret {
+			return
+		}
+	}
+
+	r.secrets = append(r.secrets, secret)
+}
+
+// heldBackLength gets the length of the longest end of the string which is the start of a secret, but not the whole secret.
+func (r *Redactor) heldBackLength(s string) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	longest := 0
+
+	for _, secret := range r.secrets {
+		for length := len(secret) - 1; length > longest; length-- {
+			if length <= len(s) && strings.HasSuffix(s, secret[:length]) {
+				longest = length
+				break
+			}
+		}
+	}
+
+	return longest
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	writer   io.Writer
+	mutex    sync.Mutex
+	// pending is the end of the previous writes which is held back because it could be the start of a secret.
+	pending string
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	redacted := w.redactor.Redact(w.pending + string(p))
+	heldBack := w.redactor.heldBackLength(redacted)
+
+	w.pending = redacted[len(redacted)-heldBack:]
+
+	_, err := io.WriteString(w.writer, redacted[:len(redacted)-heldBack])
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close writes the output which is still held back, redacting it first.
+func (w *redactingWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	pending := w.pending
+	w.pending = ""
+
+	if pending == "" {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, w.redactor.Redact(pending))
+
+	return err
+}
@@ -0,0 +1,140 @@
+package sad_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestRedactorRedact(t *testing.T) {
+	redactor := sad.NewRedactor("hunter2", "hunter22", "", "no")
+
+	redacted := redactor.Redact("password hunter22 and hunter2, but not no")
+
+	expected := fmt.Sprintf("password %s and %s, but not no", sad.RedactedValue, sad.RedactedValue)
+
+	testutils.CompareStrings("redacted", expected, redacted, t)
+}
+
+func TestRedactorRedactMultiLine(t *testing.T) {
+	redactor := sad.NewRedactor("first line\nsecond line")
+
+	redacted := redactor.Redact("| second line\n")
+
+	expected := fmt.Sprintf("| %s\n", sad.RedactedValue)
+
+	testutils.CompareStrings("redacted", expected, redacted, t)
+}
+
+func TestRedactorAddOptions(t *testing.T) {
+	testOpts := testutils.GetTestOpts()
+	testOpts.AgeKey = "AGE-SECRET-KEY-1ABC"
+
+	redactor := sad.NewRedactor()
+	redactor.AddOptions(&testOpts)
+
+	encodedPrivateKey := testOpts.PrivateKey.ToBase64PEMString()
+	decodedPrivateKey, _ := base64.StdEncoding.DecodeString(encodedPrivateKey)
+	privateKeyLines := strings.Split(string(decodedPrivateKey), "\n")
+
+	output := strings.Join([]string{
+		testOpts.RegistryPassword,
+		testOpts.AgeKey,
+		encodedPrivateKey,
+		privateKeyLines[1],
+	}, " ")
+
+	redacted := redactor.Redact(output)
+
+	expected := strings.Repeat(sad.RedactedValue+" ", 3) + sad.RedactedValue
+
+	testutils.CompareStrings("redacted", expected, redacted, t)
+
+	if strings.Contains(redactor.Redact(privateKeyLines[0]), sad.RedactedValue) {
+		t.Errorf("Expected PEM header not to be redacted but got: %s", redactor.Redact(privateKeyLines[0]))
+	}
+}
+
+func TestRedactorAddValues(t *testing.T) {
+	redactor := sad.NewRedactor()
+	redactor.AddValues(map[string]string{
+		"FOO": "secret-value",
+		"BAR": "1",
+	})
+
+	redacted := redactor.Redact("FOO=secret-value BAR=1")
+
+	expected := fmt.Sprintf("FOO=%s BAR=1", sad.RedactedValue)
+
+	testutils.CompareStrings("redacted", expected, redacted, t)
+}
+
+func TestRedactorWriter(t *testing.T) {
+	redactor := sad.NewRedactor("hunter2")
+
+	var buffer bytes.Buffer
+
+	writer := redactor.Writer(&buffer)
+
+	fmt.Fprintln(writer, "Error logging in with hunter2")
+
+	expected := fmt.Sprintf("Error logging in with %s\n", sad.RedactedValue)
+
+	testutils.CompareStrings("output", expected, buffer.String(), t)
+}
+
+func TestRedactorWriterSplitSecret(t *testing.T) {
+	redactor := sad.NewRedactor("hunter2")
+
+	var buffer bytes.Buffer
+
+	writer := redactor.Writer(&buffer)
+
+	fmt.Fprint(writer, "password: hun")
+	testutils.CompareStrings("output before the rest of the secret", "password: ", buffer.String(), t)
+
+	fmt.Fprint(writer, "ter2 and hunt")
+	writer.Close()
+
+	expected := fmt.Sprintf("password: %s and hunt", sad.RedactedValue)
+
+	testutils.CompareStrings("output", expected, buffer.String(), t)
+}
+
+func TestRedactorWriterNoPartialSecret(t *testing.T) {
+	redactor := sad.NewRedactor("hunter2")
+
+	var buffer bytes.Buffer
+
+	writer := redactor.Writer(&buffer)
+
+	fmt.Fprint(writer, "Opening SSH connection... ")
+
+	testutils.CompareStrings("output", "Opening SSH connection... ", buffer.String(), t)
+}
+
+func TestRedactorWriteGitHubMasks(t *testing.T) {
+	redactor := sad.NewRedactor("hunter2", "first line\nsecond line")
+
+	var buffer bytes.Buffer
+
+	err := redactor.WriteGitHubMasks(&buffer)
+
+	if err != nil {
+		t.Fatalf("Error writing GitHub masks: %s", err)
+	}
+
+	expected := []string{
+		"::add-mask::hunter2",
+		"::add-mask::first line",
+		"::add-mask::second line",
+	}
+
+	testutils.CompareReaderLines("GitHub masks", expected, &buffer, t)
+}
@@ -0,0 +1,78 @@
+package sad
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The patterns below follow the Docker image reference grammar.
+// See https://github.com/distribution/distribution/blob/main/reference/reference.go.
+var (
+	domainComponentPattern = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	domainPattern          = domainComponentPattern + `(?:\.` + domainComponentPattern + `)*(?::[0-9]+)?`
+	pathComponentPattern   = `[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*`
+	namePattern            = pathComponentPattern + `(?:/` + pathComponentPattern + `)*`
+	tagPattern             = `[\w][\w.-]{0,127}`
+	digestPattern          = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+
+	domainRegexp = regexp.MustCompile(`^` + domainPattern + `$`)
+	nameRegexp   = regexp.MustCompile(`^` + namePattern + `$`)
+	tagRegexp    = regexp.MustCompile(`^` + tagPattern + `$`)
+	digestRegexp = regexp.MustCompile(`^` + digestPattern + `$`)
+)
+
+// ValidateDigest validates that a digest is of the form <algorithm>:<hex>.
+// SHA-256 digests must contain exactly 64 hexadecimal characters.
+func ValidateDigest(digest string) error {
+	if !digestRegexp.MatchString(digest) {
+		return fmt.Errorf("\"%s\" is not of the form <algorithm>:<hex>", digest)
+	}
+
+	separatorIndex := strings.Index(digest, ":")
+	algorithm := digest[:separatorIndex]
+	hex := digest[separatorIndex+1:]
+
+	if algorithm == "sha256" && len(hex) != 64 {
+		return fmt.Errorf("\"%s\" has %d hexadecimal characters but sha256 digests have 64", digest, len(hex))
+	}
+
+	return nil
+}
+
+// ValidateImageName validates that an image name is a valid repository name without a registry, tag, or digest.
+func ValidateImageName(image string) error {
+	if strings.Contains(image, "@") {
+		return fmt.Errorf("\"%s\" contains a digest, which should be provided separately", image)
+	}
+
+	lastComponent := image[strings.LastIndex(image, "/")+1:]
+
+	if strings.Contains(lastComponent, ":") {
+		return fmt.Errorf("\"%s\" contains a tag, which should be provided separately", image)
+	}
+
+	if !nameRegexp.MatchString(image) {
+		return fmt.Errorf("\"%s\" is not a valid image name, which should only contain lowercase alphanumeric components separated by \"/\"", image)
+	}
+
+	return nil
+}
+
+// ValidateRegistryHost validates that a registry is a valid host with an optional port, such as "ghcr.io" or "localhost:5000".
+func ValidateRegistryHost(registry string) error {
+	if !domainRegexp.MatchString(registry) {
+		return fmt.Errorf("\"%s\" is not a valid registry host", registry)
+	}
+
+	return nil
+}
+
+// ValidateTag validates that a tag is a valid image tag.
+func ValidateTag(tag string) error {
+	if !tagRegexp.MatchString(tag) {
+		return fmt.Errorf("\"%s\" is not a valid tag", tag)
+	}
+
+	return nil
+}
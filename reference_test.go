@@ -0,0 +1,127 @@
+package sad_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jswny/sad"
+)
+
+func TestValidateDigest(t *testing.T) {
+	valid := []string{
+		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"sha512:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+
+	for _, digest := range valid {
+		if err := sad.ValidateDigest(digest); err != nil {
+			t.Errorf("Expected digest %s to be valid but got: %s", digest, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"latest",
+		"sha256:abc123",
+		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdeg",
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+
+	for _, digest := range invalid {
+		if err := sad.ValidateDigest(digest); err == nil {
+			t.Errorf("Expected digest %s to be invalid but got nil", digest)
+		}
+	}
+}
+
+func TestValidateImageName(t *testing.T) {
+	valid := []string{
+		"foo",
+		"user/foo",
+		"user/foo-bar_baz.qux",
+		"org/team/foo",
+	}
+
+	for _, image := range valid {
+		if err := sad.ValidateImageName(image); err != nil {
+			t.Errorf("Expected image %s to be valid but got: %s", image, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"user/foo:latest":       "tag",
+		"user/foo@sha256:abc":   "digest",
+		"User/Foo":              "not a valid image name",
+		"user//foo":             "not a valid image name",
+		"-foo":                  "not a valid image name",
+		"registry.io:5000/user": "not a valid image name",
+	}
+
+	for image, expected := range invalid {
+		err := sad.ValidateImageName(image)
+
+		if err == nil {
+			t.Errorf("Expected image %s to be invalid but got nil", image)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error for image %s to contain \"%s\" but got: %s", image, expected, err)
+		}
+	}
+}
+
+func TestValidateRegistryHost(t *testing.T) {
+	valid := []string{
+		"ghcr.io",
+		"localhost:5000",
+		"registry-1.docker.io",
+		"127.0.0.1:5000",
+	}
+
+	for _, registry := range valid {
+		if err := sad.ValidateRegistryHost(registry); err != nil {
+			t.Errorf("Expected registry %s to be valid but got: %s", registry, err)
+		}
+	}
+
+	invalid := []string{
+		"https://ghcr.io",
+		"ghcr.io/",
+		"-ghcr.io",
+		"ghcr.io:port",
+	}
+
+	for _, registry := range invalid {
+		if err := sad.ValidateRegistryHost(registry); err == nil {
+			t.Errorf("Expected registry %s to be invalid but got nil", registry)
+		}
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	valid := []string{
+		"latest",
+		"v1.2.3",
+		"1.2.3-alpine_3",
+	}
+
+	for _, tag := range valid {
+		if err := sad.ValidateTag(tag); err != nil {
+			t.Errorf("Expected tag %s to be valid but got: %s", tag, err)
+		}
+	}
+
+	invalid := []string{
+		".latest",
+		"-latest",
+		"v1/2",
+		strings.Repeat("a", 129),
+	}
+
+	for _, tag := range invalid {
+		if err := sad.ValidateTag(tag); err == nil {
+			t.Errorf("Expected tag %s to be invalid but got nil", tag)
+		}
+	}
+}
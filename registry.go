@@ -0,0 +1,238 @@
+package sad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DockerHubRegistryHost is the host of the registry API used for images which don't specify a registry.
+var DockerHubRegistryHost = "registry-1.docker.io"
+
+// RegistryManifestMediaTypes are the manifest media types accepted when resolving a tag to a digest.
+// Manifest lists and indexes are accepted so that the digest matches the one Docker uses when pulling multi-platform images.
+var RegistryManifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// ResolveTagDigest resolves the tag specified by the options to an image digest using the registry HTTP API V2.
+// If the registry requires a bearer token, one is requested from the realm advertised by the registry, using the registry username and password if they are set.
+// Returns the digest of the manifest the tag currently points to, or an error.
+func ResolveTagDigest(client *http.Client, opts *Options) (string, error) {
+	if opts.Tag == "" {
+		return "", fmt.Errorf("tag is <empty>")
+	}
+
+	host, repository := getRegistryAPIHostAndRepository(opts)
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, repository, url.PathEscape(opts.Tag))
+
+	response, err := requestManifest(client, manifestURL, "")
+
+	if err != nil {
+		return "", err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+
+		token, err := requestRegistryToken(client, challenge, opts)
+
+		if err != nil {
+			return "", fmt.Errorf("error authenticating to registry %s: %s", host, err)
+		}
+
+		response, err = requestManifest(client, manifestURL, token)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s requesting manifest for %s:%s from registry %s", response.Status, repository, opts.Tag, host)
+	}
+
+	digest := response.Header.Get("Docker-Content-Digest")
+
+	if digest == "" {
+		return "", fmt.Errorf("registry %s did not return a digest for %s:%s", host, repository, opts.Tag)
+	}
+
+	return digest, nil
+}
+
+func requestManifest(client *http.Client, manifestURL string, token string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodHead, manifestURL, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating manifest request for %s: %s", manifestURL, err)
+	}
+
+	request.Header.Set("Accept", strings.Join(RegistryManifestMediaTypes, ", "))
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return nil, fmt.Errorf("error requesting manifest %s: %s", manifestURL, err)
+	}
+
+	return response, nil
+}
+
+func requestRegistryToken(client *http.Client, challenge string, opts *Options) (string, error) {
+	scheme, params := parseAuthenticateChallenge(challenge)
+
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported authentication challenge \"%s\"", challenge)
+	}
+
+	realm := params["realm"]
+
+	if realm == "" {
+		return "", fmt.Errorf("authentication challenge \"%s\" has no realm", challenge)
+	}
+
+	tokenURL, err := url.Parse(realm)
+
+	if err != nil {
+		return "", fmt.Errorf("error parsing authentication realm %s: %s", realm, err)
+	}
+
+	query := tokenURL.Query()
+
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+
+	tokenURL.RawQuery = query.Encode()
+
+	request, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+
+	if err != nil {
+		return "", fmt.Errorf("error creating token request: %s", err)
+	}
+
+	if opts.RegistryUsername != "" {
+		request.SetBasicAuth(opts.RegistryUsername, opts.RegistryPassword)
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return "", fmt.Errorf("error requesting token: %s", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s requesting token", response.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&tokenResponse)
+
+	if err != nil {
+		return "", fmt.Errorf("error decoding token response: %s", err)
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+
+	if tokenResponse.AccessToken != "" {
+		return tokenResponse.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("token response did not contain a token")
+}
+
+// parseAuthenticateChallenge parses a WWW-Authenticate header value such as `Bearer realm="https://auth.io/token",service="registry.io"`.
+// Returns the scheme and a map of the parameter names to their unquoted values.
+func parseAuthenticateChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	challenge = strings.TrimSpace(challenge)
+	spaceIndex := strings.Index(challenge, " ")
+
+	if spaceIndex == -1 {
+		return challenge, params
+	}
+
+	scheme := challenge[:spaceIndex]
+	rest := challenge[spaceIndex+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		equalsIndex := strings.Index(rest, "=")
+
+		if equalsIndex == -1 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(rest[:equalsIndex]))
+		rest = rest[equalsIndex+1:]
+
+		var value string
+
+		if strings.HasPrefix(rest, "\"") {
+			closingIndex := strings.Index(rest[1:], "\"")
+
+			if closingIndex == -1 {
+				value = rest[1:]
+				rest = ""
+			} else {
+				value = rest[1 : closingIndex+1]
+				rest = rest[closingIndex+2:]
+			}
+		} else {
+			commaIndex := strings.Index(rest, ",")
+
+			if commaIndex == -1 {
+				value = rest
+				rest = ""
+			} else {
+				value = rest[:commaIndex]
+				rest = rest[commaIndex:]
+			}
+		}
+
+		params[key] = value
+	}
+
+	return scheme, params
+}
+
+// getRegistryAPIHostAndRepository gets the host of the registry API and the repository name for the image specified by the options.
+// Images without a registry are resolved against Docker Hub, where official images live under the "library/" namespace.
+func getRegistryAPIHostAndRepository(opts *Options) (string, string) {
+	host := opts.Registry
+	repository := opts.Image
+
+	if host == "" || host == "docker.io" || host == "index.docker.io" {
+		host = DockerHubRegistryHost
+
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+
+	return host, repository
+}
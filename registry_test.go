@@ -0,0 +1,164 @@
+package sad_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+var testManifestDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestResolveTagDigest(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/v2/user/foo/manifests/v1.2.3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.docker.distribution.manifest.v2+json") {
+			t.Errorf("Expected manifest media types to be accepted but got: %s", r.Header.Get("Accept"))
+		}
+
+		w.Header().Set("Docker-Content-Digest", testManifestDigest)
+	}))
+	defer server.Close()
+
+	opts := sad.Options{
+		Registry: strings.TrimPrefix(server.URL, "https://"),
+		Image:    "user/foo",
+		Tag:      "v1.2.3",
+	}
+
+	digest, err := sad.ResolveTagDigest(server.Client(), &opts)
+
+	if err != nil {
+		t.Fatalf("Error resolving tag digest: %s", err)
+	}
+
+	testutils.CompareStrings("digest", testManifestDigest, digest, t)
+}
+
+func TestResolveTagDigestBearerToken(t *testing.T) {
+	token := "abc123"
+
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			username, password, ok := r.BasicAuth()
+
+			if !ok || username != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			testutils.CompareStrings("scope", "repository:user/foo:pull", r.URL.Query().Get("scope"), t)
+
+			fmt.Fprintf(w, "{\"token\": \"%s\"}", token)
+		case "/v2/user/foo/manifests/latest":
+			if r.Header.Get("Authorization") != "Bearer "+token {
+				challenge := fmt.Sprintf("Bearer realm=\"%s/token\",service=\"registry\",scope=\"repository:user/foo:pull\"", server.URL)
+				w.Header().Set("WWW-Authenticate", challenge)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.Header().Set("Docker-Content-Digest", testManifestDigest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	opts := sad.Options{
+		Registry:         strings.TrimPrefix(server.URL, "https://"),
+		RegistryUsername: "user",
+		RegistryPassword: "secret",
+		Image:            "user/foo",
+		Tag:              "latest",
+	}
+
+	digest, err := sad.ResolveTagDigest(server.Client(), &opts)
+
+	if err != nil {
+		t.Fatalf("Error resolving tag digest: %s", err)
+	}
+
+	testutils.CompareStrings("digest", testManifestDigest, digest, t)
+}
+
+func TestResolveTagDigestNotFound(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	opts := sad.Options{
+		Registry: strings.TrimPrefix(server.URL, "https://"),
+		Image:    "user/foo",
+		Tag:      "missing",
+	}
+
+	digest, err := sad.ResolveTagDigest(server.Client(), &opts)
+
+	if err == nil {
+		t.Fatalf("Expected error resolving tag digest but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected error to contain status but got: %s", err)
+	}
+
+	testutils.CompareStrings("digest", "", digest, t)
+}
+
+func TestOptionsResolveDigest(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", testManifestDigest)
+	}))
+	defer server.Close()
+
+	opts := sad.Options{
+		Registry: strings.TrimPrefix(server.URL, "https://"),
+		Image:    "user/foo",
+		Tag:      "v1.2.3",
+	}
+
+	err := opts.ResolveDigest(server.Client())
+
+	if err != nil {
+		t.Fatalf("Error resolving digest: %s", err)
+	}
+
+	testutils.CompareStrings("digest", testManifestDigest, opts.Digest, t)
+	testutils.CompareStrings("tag", "v1.2.3", opts.Tag, t)
+}
+
+func TestOptionsResolveDigestMismatch(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Content-Digest", testManifestDigest)
+	}))
+	defer server.Close()
+
+	opts := sad.Options{
+		Registry: strings.TrimPrefix(server.URL, "https://"),
+		Image:    "user/foo",
+		Digest:   "sha256:abc123",
+		Tag:      "v1.2.3",
+	}
+
+	err := opts.ResolveDigest(server.Client())
+
+	if err == nil {
+		t.Fatalf("Expected error resolving mismatched digest but got nil")
+	}
+
+	testutils.CompareStrings("digest", "sha256:abc123", opts.Digest, t)
+}
@@ -0,0 +1,232 @@
+package sad
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteReleaseFileName is the name of the file in the deployment directory which describes the release currently running.
+var RemoteReleaseFileName string = ".sad-release.json"
+
+// RemoteAuditLogFileName is the name of the audit log in the deployment directory, which has a line for each deployment.
+var RemoteAuditLogFileName string = ".sad-history.jsonl"
+
+// ReleaseStatusSucceeded is the status of a deployment which finished successfully.
+// ReleaseStatusFailed is the status of a deployment which failed after connecting to the server.
+var (
+	ReleaseStatusSucceeded = "succeeded"
+	ReleaseStatusFailed    = "failed"
+)
+
+// gitHubActorEnvVar and gitHubSHAEnvVar are set by GitHub Actions to the user who triggered the workflow and the commit it runs for.
+var (
+	gitHubActorEnvVar = "GITHUB_ACTOR"
+	gitHubSHAEnvVar   = "GITHUB_SHA"
+)
+
+// Release describes a deployment: what was deployed, by whom, from which commit, when, and whether it succeeded.
+type Release struct {
+	DeploymentName string    `json:"deploymentName"`
+	Image          string    `json:"image"`
+	Digest         string    `json:"digest"`
+	Tag            string    `json:"tag,omitempty"`
+	Channel        string    `json:"channel"`
+	Deployer       string    `json:"deployer"`
+	GitSHA         string    `json:"gitSHA,omitempty"`
+	StartedAt      time.Time `json:"startedAt"`
+	FinishedAt     time.Time `json:"finishedAt"`
+	Status         string    `json:"status,omitempty"`
+}
+
+// NewRelease creates a release for the deployment specified by the options, which started at the specified time.
+// The deployer is the GitHub user who triggered the workflow when running in GitHub Actions, and the local user and host otherwise.
+// The Git SHA is the commit the workflow runs for in GitHub Actions, and the commit checked out in the specified directory otherwise, if any.
+func NewRelease(fromPath string, opts *Options, startedAt time.Time) (*Release, error) {
+	deploymentName, err := opts.GetDeploymentName()
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting deployment name: %s", err)
+	}
+
+	deployer := os.Getenv(gitHubActorEnvVar)
+
+	if deployer == "" {
+		owner, host := getLocalOwner()
+		deployer = owner + "@" + host
+	}
+
+	gitSHA := os.Getenv(gitHubSHAEnvVar)
+
+	if gitSHA == "" {
+		gitSHA = getGitSHA(fromPath)
+	}
+
+	release := &Release{
+		DeploymentName: deploymentName,
+		Image:          opts.GetImageSpecifier(),
+		Digest:         opts.Digest,
+		Tag:            opts.Tag,
+		Channel:        opts.Channel,
+		Deployer:       deployer,
+		GitSHA:         gitSHA,
+		StartedAt:      startedAt.UTC(),
+	}
+
+	return release, nil
+}
+
+// Finish records that the release finished at the specified time with the specified status.
+func (r *Release) Finish(status string, finishedAt time.Time) {
+	r.Status = status
+	r.FinishedAt = finishedAt.UTC()
+}
+
+// Duration gets how long the deployment took, or 0 if it hasn't finished.
+func (r *Release) Duration() time.Duration {
+	if r.FinishedAt.IsZero() {
+		return 0
+	}
+
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// WriteRelease writes the release to the release file in the deployment directory on the server, replacing the previous release.
+func WriteRelease(sshClient *ssh.Client, remotePath string, release *Release) error {
+	data, err := json.MarshalIndent(release, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("error marshaling release: %s", err)
+	}
+
+	_, err = SSHRunCommandWithStdin(sshClient, GetWriteReleaseCommand(remotePath), strings.NewReader(string(data)+"\n"))
+
+	return err
+}
+
+// AppendAuditLog appends the release as a line to the audit log in the deployment directory on the server.
+// The audit log is only changed while the specified lock holds the deployment directory, so that concurrent deployments can't interleave their changes.
+func AppendAuditLog(sshClient *ssh.Client, remotePath string, lock *Lock, release *Release) error {
+	data, err := json.Marshal(release)
+
+	if err != nil {
+		return fmt.Errorf("error marshaling release: %s", err)
+	}
+
+	_, err = SSHRunCommandWithStdin(sshClient, GetAppendAuditLogCommand(remotePath, lock.ID), strings.NewReader(string(data)+"\n"))
+
+	return err
+}
+
+// ReadRelease reads the release currently running from the release file in the deployment directory on the server.
+// Returns nil if nothing has been deployed yet.
+func ReadRelease(sshClient *ssh.Client, remotePath string) (*Release, error) {
+	output, err := SSHRunCommand(sshClient, getReadIfExistsCommand(remotePath+"/"+RemoteReleaseFileName))
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading release file: %s", err)
+	}
+
+	if strings.TrimSpace(output) == "" {
+		return nil, nil
+	}
+
+	var release Release
+
+	if err := json.Unmarshal([]byte(output), &release); err != nil {
+		return nil, fmt.Errorf("error parsing release file: %s", err)
+	}
+
+	return &release, nil
+}
+
+// ReadAuditLog reads all of the releases from the audit log in the deployment directory on the server, oldest first.
+// Returns no releases if nothing has been deployed yet.
+func ReadAuditLog(sshClient *ssh.Client, remotePath string) ([]Release, error) {
+	output, err := SSHRunCommand(sshClient, getReadIfExistsCommand(remotePath+"/"+RemoteAuditLogFileName))
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit log: %s", err)
+	}
+
+	return ParseAuditLog(output)
+}
+
+// ParseAuditLog parses the content of an audit log, with one release per line.
+// Blank lines are skipped.
+func ParseAuditLog(content string) ([]Release, error) {
+	var releases []Release
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		var release Release
+
+		if err := json.Unmarshal([]byte(line), &release); err != nil {
+			return nil, fmt.Errorf("error parsing audit log line %d: %s", lineNumber, err)
+		}
+
+		releases = append(releases, release)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %s", err)
+	}
+
+	return releases, nil
+}
+
+// GetWriteReleaseCommand gets the command which writes the release file in the deployment directory from its standard input.
+// The file is written to a temporary file first and then moved into place, so that it is never partially written.
+func GetWriteReleaseCommand(remotePath string) string {
+	releasePath := shellQuote(remotePath + "/" + RemoteReleaseFileName)
+	tempPath := shellQuote(remotePath + "/" + RemoteReleaseFileName + ".tmp")
+
+	return fmt.Sprintf("cat > %s && mv %s %s", tempPath, tempPath, releasePath)
+}
+
+// GetAppendAuditLogCommand gets the command which appends its standard input to the audit log in the deployment directory.
+// The command fails without changing the audit log if the lock file does not contain the specified lock ID.
+func GetAppendAuditLogCommand(remotePath string, lockID string) string {
+	return getWhileLockedCommand(remotePath, lockID, fmt.Sprintf("cat >> %s", shellQuote(remotePath+"/"+RemoteAuditLogFileName)))
+}
+
+// GetContainerStatusCommand gets the command which prints the status of the deployment container, such as "running" or "exited".
+func GetContainerStatusCommand(containerName string) string {
+	return fmt.Sprintf("docker inspect --format '{{.State.Status}}' %s", shellQuote(containerName))
+}
+
+func getReadIfExistsCommand(filePath string) string {
+	quotedPath := shellQuote(filePath)
+
+	return fmt.Sprintf("if [ -f %s ]; then cat %s; fi", quotedPath, quotedPath)
+}
+
+// getGitSHA gets the commit checked out in the Git repository containing the specified directory, or an empty string if there isn't one.
+func getGitSHA(fromPath string) string {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = fromPath
+
+	output, err := cmd.Output()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,188 @@
+package sad_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestNewRelease(t *testing.T) {
+	os.Setenv("GITHUB_ACTOR", "octocat")
+	os.Setenv("GITHUB_SHA", "0123456789abcdef0123456789abcdef01234567")
+	defer os.Unsetenv("GITHUB_ACTOR")
+	defer os.Unsetenv("GITHUB_SHA")
+
+	opts := sad.Options{
+		Registry: "ghcr.io",
+		Image:    "user/foo",
+		Digest:   "sha256:abc123",
+		Tag:      "v1.2.3",
+		Channel:  "prod",
+	}
+
+	startedAt := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	release, err := sad.NewRelease(".", &opts, startedAt)
+
+	if err != nil {
+		t.Fatalf("Error creating release: %s", err)
+	}
+
+	testutils.CompareStrings("deployment name", "user-foo-prod", release.DeploymentName, t)
+	testutils.CompareStrings("image", "ghcr.io/user/foo@sha256:abc123", release.Image, t)
+	testutils.CompareStrings("digest", "sha256:abc123", release.Digest, t)
+	testutils.CompareStrings("tag", "v1.2.3", release.Tag, t)
+	testutils.CompareStrings("channel", "prod", release.Channel, t)
+	testutils.CompareStrings("deployer", "octocat", release.Deployer, t)
+	testutils.CompareStrings("git SHA", "0123456789abcdef0123456789abcdef01234567", release.GitSHA, t)
+
+	if !release.StartedAt.Equal(startedAt) {
+		t.Errorf("Expected started at %s but got %s", startedAt, release.StartedAt)
+	}
+
+	finishedAt := startedAt.Add(time.Minute)
+	release.Finish(sad.ReleaseStatusSucceeded, finishedAt)
+
+	testutils.CompareStrings("status", sad.ReleaseStatusSucceeded, release.Status, t)
+
+	if !release.FinishedAt.Equal(finishedAt) {
+		t.Errorf("Expected finished at %s but got %s", finishedAt, release.FinishedAt)
+	}
+}
+
+func TestNewReleaseLocal(t *testing.T) {
+	opts := sad.Options{
+		Image:   "user/foo",
+		Digest:  "sha256:abc123",
+		Channel: "beta",
+	}
+
+	tempDirPath, err := ioutil.TempDir("", "sad-release-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	release, err := sad.NewRelease(tempDirPath, &opts, time.Now())
+
+	if err != nil {
+		t.Fatalf("Error creating release: %s", err)
+	}
+
+	if !strings.Contains(release.Deployer, "@") {
+		t.Errorf("Expected deployer of the form user@host but got: %s", release.Deployer)
+	}
+
+	testutils.CompareStrings("git SHA", "", release.GitSHA, t)
+}
+
+func TestParseAuditLog(t *testing.T) {
+	content := `{"deploymentName": "user-foo-beta", "image": "user/foo@sha256:abc123", "digest": "sha256:abc123", "channel": "beta", "deployer": "octocat", "startedAt": "2021-09-01T12:00:00Z", "finishedAt": "2021-09-01T12:01:00Z", "status": "succeeded"}
+
+{"deploymentName": "user-foo-beta", "image": "user/foo@sha256:def456", "digest": "sha256:def456", "channel": "beta", "deployer": "octocat", "startedAt": "2021-09-02T12:00:00Z", "finishedAt": "2021-09-02T12:01:00Z", "status": "failed"}
+`
+
+	releases, err := sad.ParseAuditLog(content)
+
+	if err != nil {
+		t.Fatalf("Error parsing audit log: %s", err)
+	}
+
+	if len(releases) != 2 {
+		t.Fatalf("Expected 2 releases but got %d", len(releases))
+	}
+
+	testutils.CompareStrings("digest", "sha256:abc123", releases[0].Digest, t)
+	testutils.CompareStrings("status", sad.ReleaseStatusFailed, releases[1].Status, t)
+
+	releases, err = sad.ParseAuditLog("")
+
+	if err != nil || len(releases) != 0 {
+		t.Errorf("Expected no releases from empty audit log but got %v, %v", releases, err)
+	}
+
+	_, err = sad.ParseAuditLog("{}\nnot json\n")
+
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error parsing line 2 of the audit log but got: %v", err)
+	}
+}
+
+func TestReleaseCommandsShell(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "sad-release-test-")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	runShell := func(cmd string, stdin string) {
+		shell := exec.Command("sh", "-c", cmd)
+		shell.Stdin = strings.NewReader(stdin)
+
+		if err := shell.Run(); err != nil {
+			t.Fatalf("Error running command %s: %s", cmd, err)
+		}
+	}
+
+	lock := writeTestLockFile(tempDirPath, t)
+
+	runShell(sad.GetWriteReleaseCommand(tempDirPath), "first\n")
+	runShell(sad.GetWriteReleaseCommand(tempDirPath), "second\n")
+	runShell(sad.GetAppendAuditLogCommand(tempDirPath, lock.ID), "first\n")
+	runShell(sad.GetAppendAuditLogCommand(tempDirPath, lock.ID), "second\n")
+
+	release, err := ioutil.ReadFile(filepath.Join(tempDirPath, sad.RemoteReleaseFileName))
+
+	if err != nil {
+		t.Fatalf("Error reading release file: %s", err)
+	}
+
+	testutils.CompareStrings("release file", "second\n", string(release), t)
+
+	auditLog, err := ioutil.ReadFile(filepath.Join(tempDirPath, sad.RemoteAuditLogFileName))
+
+	if err != nil {
+		t.Fatalf("Error reading audit log: %s", err)
+	}
+
+	testutils.CompareStrings("audit log", "first\nsecond\n", string(auditLog), t)
+
+	other, _ := sad.NewLock()
+
+	shell := exec.Command("sh", "-c", sad.GetAppendAuditLogCommand(tempDirPath, other.ID))
+	shell.Stdin = strings.NewReader("third\n")
+
+	if err := shell.Run(); err == nil {
+		t.Errorf("Expected error appending to the audit log without holding the lock but got nil")
+	}
+
+	auditLog, err = ioutil.ReadFile(filepath.Join(tempDirPath, sad.RemoteAuditLogFileName))
+
+	if err != nil {
+		t.Fatalf("Error reading audit log: %s", err)
+	}
+
+	testutils.CompareStrings("audit log", "first\nsecond\n", string(auditLog), t)
+
+	if _, err := os.Stat(filepath.Join(tempDirPath, sad.RemoteReleaseFileName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary release file to be moved but got: %v", err)
+	}
+}
+
+func TestGetContainerStatusCommand(t *testing.T) {
+	cmd := sad.GetContainerStatusCommand("user-foo-beta")
+
+	testutils.CompareStrings("command", "docker inspect --format '{{.State.Status}}' 'user-foo-beta'", cmd, t)
+}
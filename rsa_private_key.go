@@ -49,6 +49,37 @@ func (k *RSAPrivateKey) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalYAML marshals an RSA private key into a YAML value.
+// The key is marshalled into a base64 encoded PEM block string.
+func (k RSAPrivateKey) MarshalYAML() (interface{}, error) {
+	return k.ToBase64PEMString(), nil
+}
+
+// UnmarshalYAML unmarshals a YAML value into an RSA private key.
+// The key should be a base64 encoded PEM block string.
+func (k *RSAPrivateKey) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var unmarshaled string
+	err := unmarshal(&unmarshaled)
+
+	if err != nil {
+		return err
+	}
+
+	return k.ParseBase64PEMString(unmarshaled)
+}
+
+// MarshalText marshals an RSA private key into text, which is used for TOML.
+// The key is marshalled into a base64 encoded PEM block string.
+func (k RSAPrivateKey) MarshalText() ([]byte, error) {
+	return []byte(k.ToBase64PEMString()), nil
+}
+
+// UnmarshalText unmarshals text into an RSA private key, which is used for TOML.
+// The key should be a base64 encoded PEM block string.
+func (k *RSAPrivateKey) UnmarshalText(data []byte) error {
+	return k.ParseBase64PEMString(string(data))
+}
+
 // ToBase64PEMString converts an RSA private key into a base 64 encoded PEM block string.
 func (k *RSAPrivateKey) ToBase64PEMString() string {
 	var data []byte
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"gopkg.in/yaml.v2"
+
 	"github.com/jswny/sad"
 	testutils "github.com/jswny/sad/internal"
 )
@@ -112,3 +114,47 @@ func TestRSAPrivateKeyToSSHAuthMethod(t *testing.T) {
 		t.Errorf("Error converting RSA private key to SSH auth method")
 	}
 }
+
+func TestRSAPrivateKeyUnmarshalYAML(t *testing.T) {
+	rsaPrivateKey := testutils.GenerateRSAPrivateKey()
+
+	data, err := yaml.Marshal(rsaPrivateKey)
+
+	if err != nil {
+		t.Fatalf("Error marshaling RSA private key to YAML: %s", err)
+	}
+
+	rsaPrivateKey2 := sad.RSAPrivateKey{}
+
+	err = yaml.Unmarshal(data, &rsaPrivateKey2)
+
+	if err != nil {
+		t.Fatalf("Error unmarshaling RSA private key from YAML: %s", err)
+	}
+
+	if !rsaPrivateKey.PrivateKey.Equal(rsaPrivateKey2.PrivateKey) {
+		t.Errorf("Expected marshaled and unmarshaled private keys to be equal, but they were not")
+	}
+}
+
+func TestRSAPrivateKeyUnmarshalText(t *testing.T) {
+	rsaPrivateKey := testutils.GenerateRSAPrivateKey()
+
+	data, err := rsaPrivateKey.MarshalText()
+
+	if err != nil {
+		t.Fatalf("Error marshaling RSA private key to text: %s", err)
+	}
+
+	rsaPrivateKey2 := sad.RSAPrivateKey{}
+
+	err = rsaPrivateKey2.UnmarshalText(data)
+
+	if err != nil {
+		t.Fatalf("Error unmarshaling RSA private key from text: %s", err)
+	}
+
+	if !rsaPrivateKey.PrivateKey.Equal(rsaPrivateKey2.PrivateKey) {
+		t.Errorf("Expected marshaled and unmarshaled private keys to be equal, but they were not")
+	}
+}
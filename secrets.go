@@ -0,0 +1,80 @@
+package sad
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// LocalSecretsFileName is the name of the age-encrypted dotenv file containing secrets to inject into the deployment.
+// The file should be located next to the local Docker Compose file, and it is optional.
+var LocalSecretsFileName string = ".sad.secrets.env.age"
+
+// DecryptSecrets decrypts an age-encrypted dotenv file using the provided age key, which may contain multiple identities on separate lines.
+// Both binary and armored (PEM-like) encrypted files are supported.
+// The decrypted content is only kept in memory.
+// Returns a map of the variable names to values, see ParseDotEnv.
+func DecryptSecrets(reader io.Reader, ageKey string) (map[string]string, error) {
+	identities, err := age.ParseIdentities(strings.NewReader(ageKey))
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing age key: %s", err)
+	}
+
+	bufferedReader := bufio.NewReader(reader)
+	header, _ := bufferedReader.Peek(len(armor.Header))
+
+	var encryptedReader io.Reader = bufferedReader
+
+	if bytes.Equal(header, []byte(armor.Header)) {
+		encryptedReader = armor.NewReader(bufferedReader)
+	}
+
+	decryptedReader, err := age.Decrypt(encryptedReader, identities...)
+
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secrets: %s", err)
+	}
+
+	secrets, err := ParseDotEnv(decryptedReader)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing decrypted secrets: %s", err)
+	}
+
+	return secrets, nil
+}
+
+// ReadSecretsFile reads and decrypts the secrets file at the specified path using the age key from the options, see DecryptSecrets.
+// Returns nil if the file does not exist, or an error if it exists but there is no age key to decrypt it with.
+func ReadSecretsFile(path string, opts *Options) (map[string]string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	if opts.AgeKey == "" {
+		return nil, fmt.Errorf("found secrets file %s but the age key is <empty>, it should be provided with %sAGE_KEY", path, OptionEnvVarPrefix)
+	}
+
+	secrets, err := DecryptSecrets(file, opts.AgeKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading secrets file %s: %s", path, err)
+	}
+
+	return secrets, nil
+}
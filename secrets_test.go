@@ -0,0 +1,191 @@
+package sad_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+var testSecretsContent = "SECRET=hunter2\nTOKEN=\"abc 123\"\n"
+
+func TestDecryptSecrets(t *testing.T) {
+	identity := generateAgeIdentity(t)
+	encrypted := encryptSecrets(testSecretsContent, identity, false, t)
+
+	secrets, err := sad.DecryptSecrets(bytes.NewReader(encrypted), identity.String())
+
+	if err != nil {
+		t.Fatalf("Error decrypting secrets: %s", err)
+	}
+
+	testutils.CompareStrings("variable SECRET", "hunter2", secrets["SECRET"], t)
+	testutils.CompareStrings("variable TOKEN", "abc 123", secrets["TOKEN"], t)
+}
+
+func TestDecryptSecretsArmored(t *testing.T) {
+	identity := generateAgeIdentity(t)
+	encrypted := encryptSecrets(testSecretsContent, identity, true, t)
+
+	key := "# created: 2021-01-01T00:00:00Z\n" + identity.String() + "\n"
+
+	secrets, err := sad.DecryptSecrets(bytes.NewReader(encrypted), key)
+
+	if err != nil {
+		t.Fatalf("Error decrypting secrets: %s", err)
+	}
+
+	testutils.CompareStrings("variable SECRET", "hunter2", secrets["SECRET"], t)
+}
+
+func TestDecryptSecretsWrongKey(t *testing.T) {
+	identity := generateAgeIdentity(t)
+	encrypted := encryptSecrets(testSecretsContent, identity, false, t)
+
+	secrets, err := sad.DecryptSecrets(bytes.NewReader(encrypted), generateAgeIdentity(t).String())
+
+	if err == nil {
+		t.Fatalf("Expected error decrypting secrets with the wrong key but got nil")
+	}
+
+	if secrets != nil {
+		t.Errorf("Expected nil secrets but got: %s", secrets)
+	}
+}
+
+func TestReadSecretsFile(t *testing.T) {
+	identity := generateAgeIdentity(t)
+	path := writeSecretsFile(encryptSecrets(testSecretsContent, identity, false, t), t)
+	defer os.Remove(path)
+
+	opts := sad.Options{
+		AgeKey: identity.String(),
+	}
+
+	secrets, err := sad.ReadSecretsFile(path, &opts)
+
+	if err != nil {
+		t.Fatalf("Error reading secrets file: %s", err)
+	}
+
+	testutils.CompareStrings("variable SECRET", "hunter2", secrets["SECRET"], t)
+}
+
+func TestReadSecretsFileMissing(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "sad-missing-secrets.env.age")
+
+	opts := sad.Options{}
+
+	secrets, err := sad.ReadSecretsFile(path, &opts)
+
+	if err != nil {
+		t.Fatalf("Error reading missing secrets file: %s", err)
+	}
+
+	if secrets != nil {
+		t.Errorf("Expected nil secrets but got: %s", secrets)
+	}
+}
+
+func TestReadSecretsFileNoKey(t *testing.T) {
+	identity := generateAgeIdentity(t)
+	path := writeSecretsFile(encryptSecrets(testSecretsContent, identity, false, t), t)
+	defer os.Remove(path)
+
+	opts := sad.Options{}
+
+	_, err := sad.ReadSecretsFile(path, &opts)
+
+	if err == nil {
+		t.Fatalf("Expected error reading secrets file without a key but got nil")
+	}
+
+	if !strings.Contains(err.Error(), "SAD_AGE_KEY") {
+		t.Errorf("Expected error to mention the age key variable but got: %s", err)
+	}
+}
+
+func TestGetDeploymentEnvValuesWithSecrets(t *testing.T) {
+	opts := sad.Options{
+		EnvVars:   []string{"SECRET", "FROM_VALUES", "FROM_ENV"},
+		EnvValues: map[string]string{"SECRET": "value", "FROM_VALUES": "value"},
+	}
+
+	os.Setenv(sad.DeploymentEnvVarPrefix+"FROM_ENV", "env")
+	defer os.Unsetenv(sad.DeploymentEnvVarPrefix + "FROM_ENV")
+
+	secrets := map[string]string{
+		"SECRET":   "secret",
+		"FROM_ENV": "secret",
+	}
+
+	env, err := opts.GetDeploymentEnvValuesWithSecrets(secrets)
+
+	if err != nil {
+		t.Fatalf("Error getting deployment environment values: %s", err)
+	}
+
+	testutils.CompareStrings("variable SECRET", "secret", env["SECRET"], t)
+	testutils.CompareStrings("variable FROM_VALUES", "value", env["FROM_VALUES"], t)
+	testutils.CompareStrings("variable FROM_ENV", "env", env["FROM_ENV"], t)
+}
+
+func generateAgeIdentity(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+
+	if err != nil {
+		t.Fatalf("Error generating age identity: %s", err)
+	}
+
+	return identity
+}
+
+func encryptSecrets(content string, identity *age.X25519Identity, armored bool, t *testing.T) []byte {
+	var buffer bytes.Buffer
+
+	var output io.Writer = &buffer
+	var armorWriter io.WriteCloser
+
+	if armored {
+		armorWriter = armor.NewWriter(&buffer)
+		output = armorWriter
+	}
+
+	writer, err := age.Encrypt(output, identity.Recipient())
+
+	if err != nil {
+		t.Fatalf("Error encrypting secrets: %s", err)
+	}
+
+	io.WriteString(writer, content)
+	writer.Close()
+
+	if armorWriter != nil {
+		armorWriter.Close()
+	}
+
+	return buffer.Bytes()
+}
+
+func writeSecretsFile(encrypted []byte, t *testing.T) string {
+	file, err := ioutil.TempFile("", sad.LocalSecretsFileName)
+
+	if err != nil {
+		t.Fatalf("Error creating secrets file: %s", err)
+	}
+
+	defer file.Close()
+
+	file.Write(encrypted)
+
+	return file.Name()
+}
@@ -0,0 +1,266 @@
+package sad
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SyncModeAll sends all of the files on every deployment.
+// SyncModeChanged only sends the files which changed since the last deployment, according to the remote manifest.
+// SyncModeMirror also removes the files sent by the last deployment which are no longer being deployed.
+var (
+	SyncModeAll     = "all"
+	SyncModeChanged = "changed"
+	SyncModeMirror  = "mirror"
+)
+
+// SyncModes are all of the supported sync modes.
+var SyncModes = []string{
+	SyncModeAll,
+	SyncModeChanged,
+	SyncModeMirror,
+}
+
+// RemoteManifestFileName is the name of the remote manifest file, which records the hashes of the files sent by the last deployment.
+var RemoteManifestFileName string = ".sad-manifest.json"
+
+// Manifest records each file sent to the server, keyed by its path relative to the deployment directory.
+type Manifest struct {
+	Files map[string]ManifestEntry `json:"files"`
+}
+
+// ManifestEntry records the SHA-256 hash of the content of a file sent to the server, along with its permissions.
+type ManifestEntry struct {
+	SHA256      string `json:"sha256"`
+	Permissions string `json:"permissions"`
+}
+
+// SyncResult describes the files which were added, changed, removed, or left unchanged on the server by a sync.
+// Each list contains paths relative to the deployment directory, sorted.
+type SyncResult struct {
+	Added     []string
+	Changed   []string
+	Removed   []string
+	Unchanged []string
+}
+
+// String summarizes the result with the number of files in each list.
+func (r *SyncResult) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed, %d unchanged", len(r.Added), len(r.Changed), len(r.Removed), len(r.Unchanged))
+}
+
+// ComputeSyncPlan compares a local manifest with the remote manifest from the last deployment.
+// Files are changed if either their content or their permissions are different.
+// Files which are not in the local manifest are only listed as removed if remove is true.
+func ComputeSyncPlan(local *Manifest, remote *Manifest, remove bool) *SyncResult {
+	result := &SyncResult{}
+
+	for filePath, entry := range local.Files {
+		remoteEntry, ok := remote.Files[filePath]
+
+		if !ok {
+			result.Added = append(result.Added, filePath)
+		} else if remoteEntry != entry {
+			result.Changed = append(result.Changed, filePath)
+		} else {
+			result.Unchanged = append(result.Unchanged, filePath)
+		}
+	}
+
+	if remove {
+		for filePath := range remote.Files {
+			if _, ok := local.Files[filePath]; !ok {
+				result.Removed = append(result.Removed, filePath)
+			}
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Changed)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Unchanged)
+
+	return result
+}
+
+// ParseManifest parses a manifest from its JSON content.
+// Empty content is parsed as an empty manifest, since there is no manifest before the first deployment.
+// Returns an error if any of the paths in the manifest escape the deployment directory.
+func ParseManifest(content string) (*Manifest, error) {
+	manifest := &Manifest{}
+
+	if strings.TrimSpace(content) != "" {
+		if err := json.Unmarshal([]byte(content), manifest); err != nil {
+			return nil, fmt.Errorf("error parsing manifest: %s", err)
+		}
+	}
+
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]ManifestEntry)
+	}
+
+	for filePath := range manifest.Files {
+		if err := ValidateRemoteRelativePath(filePath); err != nil {
+			return nil, fmt.Errorf("invalid path in manifest: %s", err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// GetReadManifestCommand gets the command which prints the manifest at the specified path on the server, or nothing if it does not exist.
+func GetReadManifestCommand(manifestPath string) string {
+	quoted := shellQuote(manifestPath)
+
+	return fmt.Sprintf("if [ -f %s ]; then cat %s; fi", quoted, quoted)
+}
+
+// GetRemoveFilesCommand gets the command which removes the files at the specified paths on the server.
+func GetRemoveFilesCommand(filePaths []string) string {
+	quotedPaths := make([]string, len(filePaths))
+
+	for i, filePath := range filePaths {
+		quotedPaths[i] = shellQuote(filePath)
+	}
+
+	return "rm -f " + strings.Join(quotedPaths, " ")
+}
+
+// SyncFiles sends the files to the server like SendFiles, but skips the files which are unchanged since the last deployment according to the remote manifest (see RemoteManifestFileName).
+// If remove is true, the files sent by the last deployment which are no longer being deployed are removed from the server.
+// Secret files are always sent, since the secrets directory is recreated on each deployment, and they are not recorded in the manifest.
+// The manifest is replaced after the files have been sent, and it is removed while they are being sent so that it never describes files which were not sent.
+// Returns the result of the sync, or an error.
+func SyncFiles(sshClient *ssh.Client, opts *Options, files map[string]io.Reader, remove bool) (*SyncResult, error) {
+	deploymentName, err := opts.GetDeploymentName()
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting full app name: %s", err)
+	}
+
+	deploymentPath := fmt.Sprintf("%s/%s", opts.RootDir, deploymentName)
+	manifestPath := deploymentPath + "/" + RemoteManifestFileName
+
+	output, err := SSHRunCommand(sshClient, GetReadManifestCommand(manifestPath))
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest from server: %s", err)
+	}
+
+	remote, err := ParseManifest(output)
+
+	if err != nil {
+		return nil, err
+	}
+
+	local, contents, err := buildManifest(files)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := ComputeSyncPlan(local, remote, remove)
+
+	filesToSend := make(map[string]io.Reader)
+
+	for fileName, reader := range files {
+		if isSecretFile(fileName) {
+			filesToSend[fileName] = reader
+		}
+	}
+
+	for _, fileName := range append(result.Added, result.Changed...) {
+		filesToSend[fileName] = contents[fileName]
+	}
+
+	if err := SendFiles(sshClient, opts, filesToSend); err != nil {
+		return nil, err
+	}
+
+	if len(result.Removed) != 0 {
+		removedPaths := make([]string, len(result.Removed))
+
+		for i, fileName := range result.Removed {
+			removedPaths[i] = deploymentPath + "/" + path.Clean(fileName)
+		}
+
+		if _, err := SSHRunCommand(sshClient, GetRemoveFilesCommand(removedPaths)); err != nil {
+			return nil, fmt.Errorf("error removing files from server: %s", err)
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(local, "", "  ")
+
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling manifest: %s", err)
+	}
+
+	err = copyFile(RemoteManifestFileName, bytes.NewReader(manifestData), manifestPath, "0644", sshClient)
+
+	if err != nil {
+		return nil, fmt.Errorf("error writing manifest to server: %s", err)
+	}
+
+	return result, nil
+}
+
+// buildManifest reads all of the files which are not secret files and hashes their content.
+// Returns the manifest along with readers for the content which was read, which keep the permissions of the original readers.
+func buildManifest(files map[string]io.Reader) (*Manifest, map[string]io.Reader, error) {
+	manifest := &Manifest{
+		Files: make(map[string]ManifestEntry),
+	}
+
+	contents := make(map[string]io.Reader)
+
+	for fileName, reader := range files {
+		if isSecretFile(fileName) {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(reader)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading file %s: %s", fileName, err)
+		}
+
+		permissions := "0644"
+		var content io.Reader = bytes.NewReader(data)
+
+		if permissionedReader, ok := reader.(PermissionedReader); ok {
+			permissions = permissionedReader.Permissions()
+			content = NewPermissionedReader(content, permissions)
+		}
+
+		hash := sha256.Sum256(data)
+
+		manifest.Files[fileName] = ManifestEntry{
+			SHA256:      hex.EncodeToString(hash[:]),
+			Permissions: permissions,
+		}
+
+		contents[fileName] = content
+	}
+
+	return manifest, contents, nil
+}
+
+func isSyncMode(mode string) bool {
+	for _, syncMode := range SyncModes {
+		if mode == syncMode {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package sad_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestComputeSyncPlan(t *testing.T) {
+	local := &sad.Manifest{
+		Files: map[string]sad.ManifestEntry{
+			"docker-compose.yml": {SHA256: "a", Permissions: "0644"},
+			"nginx/nginx.conf":   {SHA256: "b", Permissions: "0644"},
+			"tls/server.pem":     {SHA256: "c", Permissions: "0600"},
+			"init/new.sql":       {SHA256: "d", Permissions: "0644"},
+		},
+	}
+
+	remote := &sad.Manifest{
+		Files: map[string]sad.ManifestEntry{
+			"docker-compose.yml": {SHA256: "a", Permissions: "0644"},
+			"nginx/nginx.conf":   {SHA256: "old", Permissions: "0644"},
+			"tls/server.pem":     {SHA256: "c", Permissions: "0644"},
+			"init/old.sql":       {SHA256: "e", Permissions: "0644"},
+		},
+	}
+
+	result := sad.ComputeSyncPlan(local, remote, true)
+
+	compareStringLists("added", []string{"init/new.sql"}, result.Added, t)
+	compareStringLists("changed", []string{"nginx/nginx.conf", "tls/server.pem"}, result.Changed, t)
+	compareStringLists("removed", []string{"init/old.sql"}, result.Removed, t)
+	compareStringLists("unchanged", []string{"docker-compose.yml"}, result.Unchanged, t)
+
+	testutils.CompareStrings("summary", "1 added, 2 changed, 1 removed, 1 unchanged", result.String(), t)
+
+	result = sad.ComputeSyncPlan(local, remote, false)
+
+	compareStringLists("removed", nil, result.Removed, t)
+}
+
+func TestParseManifest(t *testing.T) {
+	manifest, err := sad.ParseManifest(`{"files": {"nginx/nginx.conf": {"sha256": "abc", "permissions": "0600"}}}`)
+
+	if err != nil {
+		t.Fatalf("Error parsing manifest: %s", err)
+	}
+
+	entry := manifest.Files["nginx/nginx.conf"]
+
+	testutils.CompareStrings("hash", "abc", entry.SHA256, t)
+	testutils.CompareStrings("permissions", "0600", entry.Permissions, t)
+}
+
+func TestParseManifestEmpty(t *testing.T) {
+	manifest, err := sad.ParseManifest("\n")
+
+	if err != nil {
+		t.Fatalf("Error parsing empty manifest: %s", err)
+	}
+
+	if manifest.Files == nil || len(manifest.Files) != 0 {
+		t.Errorf("Expected no files in empty manifest but got: %v", manifest.Files)
+	}
+}
+
+func TestParseManifestInvalid(t *testing.T) {
+	invalid := []string{
+		"not json",
+		`{"files": {"../outside": {"sha256": "abc"}}}`,
+		`{"files": {"/etc/passwd": {"sha256": "abc"}}}`,
+	}
+
+	for _, content := range invalid {
+		manifest, err := sad.ParseManifest(content)
+
+		if err == nil {
+			t.Errorf("Expected error parsing manifest %s but got nil", content)
+		}
+
+		if manifest != nil {
+			t.Errorf("Expected nil manifest for %s but got: %v", content, manifest)
+		}
+	}
+}
+
+func TestGetReadManifestCommand(t *testing.T) {
+	cmd := sad.GetReadManifestCommand("/srv/user-repo-beta/.sad-manifest.json")
+
+	expected := "if [ -f '/srv/user-repo-beta/.sad-manifest.json' ]; then cat '/srv/user-repo-beta/.sad-manifest.json'; fi"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestGetRemoveFilesCommand(t *testing.T) {
+	cmd := sad.GetRemoveFilesCommand([]string{"/srv/app/a.conf", "/srv/app/it's.conf"})
+
+	expected := "rm -f '/srv/app/a.conf' '/srv/app/it'\"'\"'s.conf'"
+
+	testutils.CompareStrings("command", expected, cmd, t)
+}
+
+func TestSyncFilesAfterSendFiles(t *testing.T) {
+	sshClient := testutils.StartLocalSSHServer(t)
+
+	tempDirPath, err := ioutil.TempDir("", "sad-sync-test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	opts := &sad.Options{
+		Image:   "user/repo",
+		Channel: "beta",
+		RootDir: tempDirPath,
+	}
+
+	deploymentPath := filepath.Join(tempDirPath, "user-repo-beta")
+
+	if err := os.Mkdir(deploymentPath, 0755); err != nil {
+		t.Fatalf("Error creating deployment dir: %s", err)
+	}
+
+	deploy := func(content string, sync bool) {
+		files := map[string]io.Reader{
+			sad.RemoteDockerComposeFileName: strings.NewReader(content),
+		}
+
+		if sync {
+			if _, err := sad.SyncFiles(sshClient, opts, files, false); err != nil {
+				t.Fatalf("Error syncing files: %s", err)
+			}
+		} else if err := sad.SendFiles(sshClient, opts, files); err != nil {
+			t.Fatalf("Error sending files: %s", err)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(deploymentPath, sad.RemoteDockerComposeFileName))
+
+		if err != nil {
+			t.Fatalf("Error reading deployed file: %s", err)
+		}
+
+		testutils.CompareStrings("deployed file", content, string(data), t)
+	}
+
+	deploy("version: a", true)
+	deploy("version: b", false)
+	deploy("version: a", true)
+}
+
+func compareStringLists(name string, expected []string, actual []string, t *testing.T) {
+	if strings.Join(expected, ",") != strings.Join(actual, ",") {
+		t.Errorf("Expected %s %v but got %v", name, expected, actual)
+	}
+}
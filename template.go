@@ -0,0 +1,77 @@
+package sad
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/template"
+)
+
+// TemplateData is the data available to templates rendered for the deployment, see RenderTemplate.
+// The options do not contain any secrets, so that they cannot end up in rendered files.
+type TemplateData struct {
+	Options        *Options
+	DeploymentName string
+	Channel        string
+	Server         string
+}
+
+// GetTemplateData gets the data available to templates from the resolved options.
+// The registry password, the age key, and the private key are removed from the options.
+// The channel profiles are removed as well, since they can contain secrets of their own, and the profile for the channel is already part of the resolved options.
+func GetTemplateData(opts *Options) (*TemplateData, error) {
+	deploymentName, err := opts.GetDeploymentName()
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting deployment name: %s", err)
+	}
+
+	templateOpts := opts.Clone()
+	templateOpts.RegistryPassword = ""
+	templateOpts.AgeKey = ""
+	templateOpts.PrivateKey = RSAPrivateKey{}
+	templateOpts.Channels = nil
+
+	server := ""
+
+	if opts.Server != nil {
+		server = opts.Server.String()
+	}
+
+	data := &TemplateData{
+		Options:        templateOpts,
+		DeploymentName: deploymentName,
+		Channel:        opts.Channel,
+		Server:         server,
+	}
+
+	return data, nil
+}
+
+// RenderTemplate renders the content of the reader as a Go text/template with the provided data.
+// The name is used in error messages, which include the line and column of the problem.
+// Referencing a missing map key is an error, as well as referencing an undefined field.
+func RenderTemplate(name string, reader io.Reader, data *TemplateData) (io.Reader, error) {
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading template %s: %s", name, err)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %s", err)
+	}
+
+	var buffer bytes.Buffer
+
+	err = tmpl.Execute(&buffer, data)
+
+	if err != nil {
+		return nil, fmt.Errorf("error rendering template: %s", err)
+	}
+
+	return &buffer, nil
+}
@@ -0,0 +1,235 @@
+package sad_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	testutils "github.com/jswny/sad/internal"
+
+	"github.com/jswny/sad"
+)
+
+func TestGetTemplateData(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.AgeKey = "AGE-SECRET-KEY-1ABC"
+
+	data, err := sad.GetTemplateData(&opts)
+
+	if err != nil {
+		t.Fatalf("Error getting template data: %s", err)
+	}
+
+	deploymentName, _ := opts.GetDeploymentName()
+
+	testutils.CompareStrings("deployment name", deploymentName, data.DeploymentName, t)
+	testutils.CompareStrings("channel", opts.Channel, data.Channel, t)
+	testutils.CompareStrings("server", opts.Server.String(), data.Server, t)
+	testutils.CompareStrings("image", opts.Image, data.Options.Image, t)
+	testutils.CompareStrings("registry password", "", data.Options.RegistryPassword, t)
+	testutils.CompareStrings("age key", "", data.Options.AgeKey, t)
+
+	if data.Options.PrivateKey.PrivateKey != nil {
+		t.Errorf("Expected no private key in template data")
+	}
+
+	if opts.RegistryPassword == "" || opts.PrivateKey.PrivateKey == nil {
+		t.Errorf("Expected the original options to keep their secrets")
+	}
+}
+
+func TestGetTemplateDataChannelProfiles(t *testing.T) {
+	opts := testutils.GetTestOpts()
+	opts.Channels = map[string]*sad.Options{
+		"prod": {
+			RegistryPassword: "prod-secret",
+			PrivateKey:       testutils.GenerateRSAPrivateKey(),
+			AgeKey:           "AGE-SECRET-KEY-1PROD",
+		},
+	}
+
+	data, err := sad.GetTemplateData(&opts)
+
+	if err != nil {
+		t.Fatalf("Error getting template data: %s", err)
+	}
+
+	if data.Options.Channels != nil {
+		t.Errorf("Expected no channel profiles in template data but got %d", len(data.Options.Channels))
+	}
+
+	reader := strings.NewReader(`{{ with index .Options.Channels "prod" }}{{ .RegistryPassword }}{{ .AgeKey }}{{ .PrivateKey }}{{ end }}`)
+
+	rendered, err := sad.RenderTemplate("test", reader, data)
+
+	if err != nil {
+		t.Fatalf("Error rendering template: %s", err)
+	}
+
+	content, err := ioutil.ReadAll(rendered)
+
+	if err != nil {
+		t.Fatalf("Error reading rendered template: %s", err)
+	}
+
+	testutils.CompareStrings("rendered template", "", string(content), t)
+
+	if opts.Channels["prod"].RegistryPassword != "prod-secret" {
+		t.Errorf("Expected the original channel profile to keep its secrets")
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	content := `services:
+  app:
+    image: "${IMAGE}"
+{{- if eq .Channel "prod" }}
+    deploy:
+      replicas: 3
+{{- end }}
+    labels:
+      - "name={{ .DeploymentName }}"
+      - "server={{ .Server }}"
+      - "foo={{ index .Options.EnvValues "FOO" }}"
+`
+
+	data := getTestTemplateData("prod", t)
+
+	reader, err := sad.RenderTemplate(sad.LocalDockerComposeFileName, strings.NewReader(content), data)
+
+	if err != nil {
+		t.Fatalf("Error rendering template: %s", err)
+	}
+
+	expected := `services:
+  app:
+    image: "${IMAGE}"
+    deploy:
+      replicas: 3
+    labels:
+      - "name=user-repo-prod"
+      - "server=1.2.3.4"
+      - "foo=bar"
+`
+
+	testutils.CompareStrings("rendered template", expected, testutils.ReadFromReader("rendered template", reader, t), t)
+
+	data = getTestTemplateData("beta", t)
+
+	reader, err = sad.RenderTemplate(sad.LocalDockerComposeFileName, strings.NewReader(content), data)
+
+	if err != nil {
+		t.Fatalf("Error rendering template: %s", err)
+	}
+
+	if strings.Contains(testutils.ReadFromReader("rendered template", reader, t), "replicas") {
+		t.Errorf("Expected the prod section not to be rendered for the beta channel")
+	}
+}
+
+func TestRenderTemplateUndefined(t *testing.T) {
+	invalid := map[string]string{
+		"field":     "image: foo\nreplicas: {{ .Replicas }}\n",
+		"map key":   "image: foo\nbar: {{ .Options.EnvValues.BAR }}\n",
+		"syntax":    "image: foo\nbar: {{ .Channel \n",
+		"function":  "image: foo\nbar: {{ missing .Channel }}\n",
+		"option":    "image: foo\nbar: {{ .Options.Missing }}\n",
+		"interface": "image: foo\nbar: {{ .Channel.Missing }}\n",
+	}
+
+	data := getTestTemplateData("beta", t)
+
+	for name, content := range invalid {
+		reader, err := sad.RenderTemplate(sad.LocalDockerComposeFileName, strings.NewReader(content), data)
+
+		if err == nil {
+			t.Errorf("Expected error rendering template with undefined %s but got nil", name)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), sad.LocalDockerComposeFileName+":2") {
+			t.Errorf("Expected error rendering template with undefined %s to contain the file name and line but got: %s", name, err)
+		}
+
+		if reader != nil {
+			t.Errorf("Expected nil reader for template with undefined %s", name)
+		}
+	}
+}
+
+func TestGetEntitiesForDeploymentTemplate(t *testing.T) {
+	tempDirPath, err := ioutil.TempDir("", "dir.test")
+
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tempDirPath)
+
+	contents := map[string]string{
+		sad.LocalDockerComposeFileName: "name: {{ .DeploymentName }}\n",
+		"nginx.conf":                   "server_name {{ .Channel }};\n",
+		"raw.conf":                     "raw {{ .Channel }};\n",
+	}
+
+	for fileName, content := range contents {
+		filePath := filepath.Join(tempDirPath, fileName)
+
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing to temp file \"%s\", %s", filePath, err)
+		}
+	}
+
+	opts := &sad.Options{
+		Image:    "user/repo",
+		Digest:   "abc123",
+		Channel:  "beta",
+		Template: true,
+		Files: []sad.FileInclude{
+			{Source: "nginx.conf", Template: true},
+			{Source: "raw.conf"},
+		},
+	}
+
+	composeFiles := findComposeFiles(tempDirPath, opts, t)
+
+	readerMap, files, err := sad.GetEntitiesForDeployment(tempDirPath, composeFiles, getDeploymentEnv(composeFiles, opts, t), opts)
+
+	for _, file := range files {
+		defer file.Close()
+	}
+
+	if err != nil {
+		t.Fatalf("Error getting files for deployment: %s", err)
+	}
+
+	expected := map[string]string{
+		sad.RemoteDockerComposeFileName: "name: user-repo-beta\n",
+		"nginx.conf":                    "server_name beta;\n",
+		"raw.conf":                      "raw {{ .Channel }};\n",
+	}
+
+	for fileName, content := range expected {
+		testutils.CompareStrings(fileName, content, testutils.ReadFromReader(fileName, readerMap[fileName], t), t)
+	}
+}
+
+func getTestTemplateData(channel string, t *testing.T) *sad.TemplateData {
+	opts := &sad.Options{
+		Image:     "user/repo",
+		Channel:   channel,
+		Server:    net.ParseIP("1.2.3.4"),
+		EnvValues: map[string]string{"FOO": "bar"},
+	}
+
+	data, err := sad.GetTemplateData(opts)
+
+	if err != nil {
+		t.Fatalf("Error getting template data: %s", err)
+	}
+
+	return data
+}
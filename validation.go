@@ -0,0 +1,134 @@
+package sad
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OptionSource describes where an option can be configured from.
+// Empty fields mean that the option cannot be configured from that source.
+type OptionSource struct {
+	Flag      string `json:"flag,omitempty"`
+	EnvVar    string `json:"envVar,omitempty"`
+	ConfigKey string `json:"configKey,omitempty"`
+}
+
+// String describes the option source in a human-readable way, such as `-image flag, SAD_IMAGE environment variable, or "image" in .sad.json`.
+func (s OptionSource) String() string {
+	var sources []string
+
+	if s.Flag != "" {
+		sources = append(sources, fmt.Sprintf("-%s flag", s.Flag))
+	}
+
+	if s.EnvVar != "" {
+		sources = append(sources, fmt.Sprintf("%s environment variable", s.EnvVar))
+	}
+
+	if s.ConfigKey != "" {
+		sources = append(sources, fmt.Sprintf("\"%s\" in %s", s.ConfigKey, ConfigFileName))
+	}
+
+	switch len(sources) {
+	case 0:
+		return ""
+	case 1:
+		return sources[0]
+	default:
+		return strings.Join(sources[:len(sources)-1], ", ") + ", or " + sources[len(sources)-1]
+	}
+}
+
+// OptionSources maps the name of each option as used in validation errors to where it can be configured from.
+var OptionSources = getOptionSources()
+
+// FieldError describes a problem with a single option.
+type FieldError struct {
+	// Field is the name of the option, such as "root directory".
+	Field string `json:"field"`
+	// Source is where the option can be configured from, which can be described with OptionSource.String.
+	Source OptionSource `json:"source"`
+	// Problem describes what is wrong with the option, such as "is <empty>".
+	Problem string `json:"problem"`
+}
+
+// Error formats the field error as "<field> <problem>".
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Problem)
+}
+
+// ValidationError holds all of the problems found when verifying options.
+// Errors are sorted by field name so that the output is stable.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Error formats all of the field errors into a single line.
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+
+	for i, fieldError := range e.Errors {
+		messages[i] = fieldError.Error()
+	}
+
+	return "invalid options! " + strings.Join(messages, ", ")
+}
+
+// Without gets the validation error without the problems with the specified fields, for commands which don't need all of the options.
+// Returns nil if there are no other problems.
+func (e *ValidationError) Without(fields ...string) error {
+	var fieldErrors []FieldError
+
+	for _, fieldError := range e.Errors {
+		ignored := false
+
+		for _, field := range fields {
+			if fieldError.Field == field {
+				ignored = true
+			}
+		}
+
+		if !ignored {
+			fieldErrors = append(fieldErrors, fieldError)
+		}
+	}
+
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	return &ValidationError{
+		Errors: fieldErrors,
+	}
+}
+
+// newValidationError creates a validation error from a map of field names to problems.
+// Returns nil if there are no problems.
+func newValidationError(problems map[string]string) *ValidationError {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(problems))
+
+	for field := range problems {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	fieldErrors := make([]FieldError, len(fields))
+
+	for i, field := range fields {
+		fieldErrors[i] = FieldError{
+			Field:   field,
+			Source:  OptionSources[field],
+			Problem: problems[field],
+		}
+	}
+
+	return &ValidationError{
+		Errors: fieldErrors,
+	}
+}